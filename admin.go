@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// 修改数据的接口，只有管理员可以调用，操作均记录到审计日志
+func registerAdminAPI(mux *http.ServeMux) {
+	mux.HandleFunc("POST "+apiPrefix+"/hosts/{id}/tasks", authorize(roleAdmin, handleAddHostTask))
+	mux.HandleFunc("POST "+apiPrefix+"/hosts/merge", authorize(roleAdmin, handleMergeHosts))
+	mux.HandleFunc("DELETE "+apiPrefix+"/hosts/{id}", authorize(roleAdmin, handleDeleteHost))
+	mux.HandleFunc("GET "+apiPrefix+"/audit", authorize(roleAdmin, handleAuditLog))
+}
+
+// 下发任务，客户端下次领取任务时执行
+func handleAddHostTask(w http.ResponseWriter, r *http.Request) {
+	c, ok := apiHost(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Type   string          `json:"type"`
+		Params json.RawMessage `json:"params"`
+	}
+	if !readAPIBody(w, r, &req) {
+		return
+	}
+	id, err := addTask(c.HostID, req.Type, req.Params)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+	log.Printf("【Server】 已向 %v 下发任务 #%d %v\n", c.HostID, id, req.Type)
+	audit(r, auditTask, c.HostID, fmt.Sprintf("#%d %v %s", id, req.Type, req.Params))
+	task, err := queryTask(id)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, task)
+}
+
+// 将 drop 中的记录合并到 keep
+func handleMergeHosts(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Keep string   `json:"keep"`
+		Drop []string `json:"drop"`
+	}
+	if !readAPIBody(w, r, &req) {
+		return
+	}
+	if req.Keep == "" || len(req.Drop) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", "需要指定 keep 和 drop")
+		return
+	}
+	for _, id := range append([]string{req.Keep}, req.Drop...) {
+		if _, err := queryClientInfo(id); err != nil {
+			writeDBError(w, err)
+			return
+		}
+	}
+	for _, drop := range req.Drop {
+		if err := mergeHosts(req.Keep, drop); err != nil {
+			writeAPIError(w, http.StatusBadRequest, "invalid_parameter", "合并失败: "+err.Error())
+			return
+		}
+		log.Printf("【Server】 已将记录 %v 合并到 %v\n", drop, req.Keep)
+		audit(r, auditMerge, drop, "merged into "+req.Keep)
+	}
+	c, err := queryClientInfo(req.Keep)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, HostDetail{c, isOnline(c.Updated)})
+}
+
+// 删除记录，客户端再次上报时重新建立
+func handleDeleteHost(w http.ResponseWriter, r *http.Request) {
+	hostID := r.PathValue("id")
+	if err := deleteHost(hostID); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	log.Printf("【Server】 已删除记录 %v\n", hostID)
+	audit(r, auditDelete, hostID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
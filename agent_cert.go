@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/host"
+)
+
+const (
+	agentKeyFile  = "agent.key"
+	agentCertFile = "agent.crt"
+
+	agentCertRenewBefore = 30 * 24 * time.Hour // 到期前 30 天续期
+)
+
+// 客户端证书，注册或续期后替换
+type agentCertificate struct {
+	cert  *tls.Certificate
+	token string // 服务端要求注册令牌时随 CSR 提交
+}
+
+// 握手时提供当前证书，尚未注册时不提供
+func (a *agentCertificate) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if a.cert == nil {
+		return &tls.Certificate{}, nil
+	}
+	return a.cert, nil
+}
+
+// 加载本地证书，不存在或即将过期时向服务端注册
+func (a *agentCertificate) ensure(client *http.Client, serverURL string) error {
+	if a.cert == nil {
+		if pair, err := tls.LoadX509KeyPair(filepath.Join(dataDir, agentCertFile), filepath.Join(dataDir, agentKeyFile)); err == nil {
+			a.cert = &pair
+		}
+	}
+	if a.cert != nil {
+		leaf, err := x509.ParseCertificate(a.cert.Certificate[0])
+		if err == nil && time.Until(leaf.NotAfter) > agentCertRenewBefore {
+			return nil
+		}
+	}
+	return a.enroll(client, serverURL)
+}
+
+// 生成 CSR 并向服务端申请证书，CN 为本机 HostID
+func (a *agentCertificate) enroll(client *http.Client, serverURL string) error {
+	hostID, err := host.HostID()
+	if err != nil {
+		return fmt.Errorf("获取 HostID 失败: %v", err)
+	}
+	key, err := loadAgentKey()
+	if err != nil {
+		return err
+	}
+	csrDer, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: hostID},
+	}, key)
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(EnrollRequest{
+		HostID:  hostID,
+		AgentID: getAgentID(),
+		CSR:     string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDer})),
+		Token:   a.token,
+	})
+	resp, err := client.Post(serverURL+"/enroll", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("注册失败: %w: %v", errServerUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("注册失败，服务端返回: %v %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var result EnrollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("注册失败: %v", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	pair, err := tls.X509KeyPair([]byte(result.Certificate), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+	if err != nil {
+		return fmt.Errorf("服务端返回的证书无效: %v", err)
+	}
+	if err := writeStateFile(agentCertFile, []byte(result.Certificate)); err != nil {
+		return err
+	}
+	a.cert = &pair
+	client.CloseIdleConnections() // 已建立的连接未携带新证书
+	log.Println("【Client】", "已获取客户端证书:", hostID)
+	return nil
+}
+
+// 客户端私钥，首次注册时生成，续期时沿用
+func loadAgentKey() (*ecdsa.PrivateKey, error) {
+	if block, _ := pem.Decode([]byte(readStateFile(agentKeyFile))); block != nil {
+		if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+			return key, nil
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeStateFile(agentKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
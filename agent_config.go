@@ -0,0 +1,188 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 可由服务端开关的采集项，基本的硬件和系统信息始终采集
+const (
+	collectorPrograms = "programs" // 软件列表
+	collectorDisks    = "disks"    // 物理磁盘
+	collectorNetwork  = "network"  // 网卡、网关和 DNS
+)
+
+var allCollectors = []string{collectorPrograms, collectorDisks, collectorNetwork}
+
+// 配置的作用范围，优先级依次升高
+const (
+	configScopeDefault = "default"
+	configScopeGroup   = "group"
+	configScopeHost    = "host"
+)
+
+// 服务端在上报响应中下发的客户端配置，字段为空表示沿用客户端当前的设置
+type AgentConfig struct {
+	Interval   int      `json:"interval,omitempty"`   // 上报间隔（分钟）
+	Collectors []string `json:"collectors,omitempty"` // 启用的采集项
+	Servers    []string `json:"servers,omitempty"`    // 服务端地址，格式为 host:port 或完整 URL
+	LogLevel   string   `json:"log_level,omitempty"`  // debug、info、error
+}
+
+// o 中非空的字段覆盖 c
+func (c AgentConfig) merge(o AgentConfig) AgentConfig {
+	if o.Interval > 0 {
+		c.Interval = o.Interval
+	}
+	if o.Collectors != nil {
+		c.Collectors = o.Collectors
+	}
+	if len(o.Servers) > 0 {
+		c.Servers = o.Servers
+	}
+	if o.LogLevel != "" {
+		c.LogLevel = o.LogLevel
+	}
+	return c
+}
+
+// 未配置采集项时全部启用
+func (c AgentConfig) collectorEnabled(name string) bool {
+	return c.Collectors == nil || slices.Contains(c.Collectors, name)
+}
+
+func (c AgentConfig) validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("上报间隔不能为负数")
+	}
+	for _, name := range c.Collectors {
+		if !slices.Contains(allCollectors, name) {
+			return fmt.Errorf("未知的采集项: %v，可选 %v", name, strings.Join(allCollectors, "、"))
+		}
+	}
+	for _, s := range c.Servers {
+		if strings.TrimSpace(s) == "" {
+			return fmt.Errorf("服务端地址不能为空")
+		}
+	}
+	if c.LogLevel != "" && !slices.Contains([]string{logLevelDebug, logLevelInfo, logLevelError}, c.LogLevel) {
+		return fmt.Errorf("未知的日志级别: %v", c.LogLevel)
+	}
+	return nil
+}
+
+// 主机的生效配置：默认配置、所在分组的配置、主机配置依次覆盖
+func loadAgentConfig(hostID string) (AgentConfig, error) {
+	var group string
+	err := db.QueryRow("SELECT group_name FROM host_group WHERE host_id = ?", hostID).Scan(&group)
+	if err != nil && err != sql.ErrNoRows {
+		return AgentConfig{}, err
+	}
+
+	var cfg AgentConfig
+	scopes := []struct{ scope, name string }{
+		{configScopeDefault, ""},
+		{configScopeGroup, group},
+		{configScopeHost, hostID},
+	}
+	for _, s := range scopes {
+		if s.scope == configScopeGroup && group == "" {
+			continue
+		}
+		var text string
+		err := db.QueryRow("SELECT config FROM agent_config WHERE scope = ? AND name = ?", s.scope, s.name).Scan(&text)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return AgentConfig{}, err
+		}
+		var o AgentConfig
+		if err := json.Unmarshal([]byte(text), &o); err != nil {
+			return AgentConfig{}, fmt.Errorf("配置 %v:%v 解析失败: %v", s.scope, s.name, err)
+		}
+		cfg = cfg.merge(o)
+	}
+	return cfg, nil
+}
+
+// 保存配置，配置为空时删除
+func setAgentConfig(scope, name string, cfg AgentConfig) error {
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if scope == configScopeDefault {
+		name = ""
+	}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	if string(b) == "{}" {
+		_, err = db.Exec("DELETE FROM agent_config WHERE scope = ? AND name = ?", scope, name)
+		return err
+	}
+	_, err = db.Exec(`INSERT INTO agent_config (scope, name, config, updated) VALUES (?,?,?,?)
+		ON CONFLICT (scope, name) DO UPDATE SET config = excluded.config, updated = excluded.updated`,
+		scope, name, string(b), time.Now().Format(time.RFC3339))
+	return err
+}
+
+// 设置主机所在分组，分组为空时移出分组
+func setHostGroup(hostID, group string) error {
+	if group == "" {
+		_, err := db.Exec("DELETE FROM host_group WHERE host_id = ?", hostID)
+		return err
+	}
+	_, err := db.Exec(`INSERT INTO host_group (host_id, group_name) VALUES (?,?)
+		ON CONFLICT (host_id) DO UPDATE SET group_name = excluded.group_name`, hostID, group)
+	return err
+}
+
+// 命令行设置配置和分组
+// 配置参数格式为 "default=JSON"、"group:分组=JSON" 或 "host:HostID=JSON"，分组参数格式为 "HostID,分组"
+func runConfigCommand(setConfig, setGroup string) {
+	if err := initDataBase(); err != nil {
+		log.Fatalln("【Server】", err)
+	}
+	defer closeDataBase()
+
+	if setConfig != "" {
+		target, text, ok := strings.Cut(setConfig, "=")
+		if !ok {
+			log.Fatalln("【Server】", "参数格式错误:", setConfig)
+		}
+		scope, name, _ := strings.Cut(strings.TrimSpace(target), ":")
+		if scope != configScopeDefault && scope != configScopeGroup && scope != configScopeHost {
+			log.Fatalln("【Server】", "未知的配置范围:", scope)
+		}
+		if scope != configScopeDefault && name == "" {
+			log.Fatalln("【Server】", "缺少分组或 HostID:", setConfig)
+		}
+		var cfg AgentConfig
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&cfg); err != nil {
+			log.Fatalln("【Server】", "配置解析失败:", err)
+		}
+		if err := setAgentConfig(scope, name, cfg); err != nil {
+			log.Fatalln("【Server】", "保存配置失败:", err)
+		}
+		log.Printf("【Server】 已保存 %v 配置: %v\n", target, text)
+	}
+	if setGroup != "" {
+		hostID, group, ok := strings.Cut(setGroup, ",")
+		if !ok {
+			log.Fatalln("【Server】", "参数格式错误:", setGroup)
+		}
+		if err := setHostGroup(strings.TrimSpace(hostID), strings.TrimSpace(group)); err != nil {
+			log.Fatalln("【Server】", "设置分组失败:", err)
+		}
+		log.Printf("【Server】 已将 %v 的分组设置为 %v\n", hostID, group)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/shirou/gopsutil/v4/host"
+)
+
+const (
+	agentAPIKeyFile = "agent_api_key"
+	enrollTokenFile = "enroll_token" // 未通过参数指定注册令牌时从此文件读取，便于批量部署
+)
+
+// 令牌注册获取的客户端密钥
+type agentAPIKey struct {
+	token string
+	key   string
+}
+
+func newAgentAPIKey(token string) *agentAPIKey {
+	if token == "" {
+		token = readStateFile(enrollTokenFile)
+	}
+	return &agentAPIKey{token: token, key: readStateFile(agentAPIKeyFile)}
+}
+
+// 未配置注册令牌且没有已保存的密钥时不使用密钥认证
+func (a *agentAPIKey) enabled() bool {
+	return a.token != "" || a.key != ""
+}
+
+// 没有密钥时使用注册令牌注册
+func (a *agentAPIKey) ensure(client *http.Client, serverURL string) error {
+	if a.key != "" {
+		return nil
+	}
+	if a.token == "" {
+		return fmt.Errorf("客户端密钥已失效，且未配置注册令牌")
+	}
+	hostID, err := host.HostID()
+	if err != nil {
+		return fmt.Errorf("获取 HostID 失败: %v", err)
+	}
+	body, _ := json.Marshal(EnrollRequest{
+		HostID:  hostID,
+		AgentID: getAgentID(),
+		Token:   a.token,
+	})
+	resp, err := client.Post(serverURL+"/enroll", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("注册失败: %w: %v", errServerUnreachable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("注册失败，服务端返回: %v %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var result EnrollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.APIKey == "" {
+		return fmt.Errorf("注册失败: 服务端未返回密钥")
+	}
+	if err := writeStateFile(agentAPIKeyFile, []byte(result.APIKey)); err != nil {
+		return err
+	}
+	a.key = result.APIKey
+	log.Println("【Client】", "注册成功，已保存客户端密钥")
+	return nil
+}
+
+// 服务端拒绝密钥时（被吊销或服务端数据丢失）删除本地密钥，下次上报前重新注册
+func (a *agentAPIKey) reset() {
+	a.key = ""
+	os.Remove(filepath.Join(dataDir, agentAPIKeyFile))
+}
+
+func (a *agentAPIKey) authorize(req *http.Request) {
+	if a.key != "" {
+		req.Header.Set("Authorization", "Bearer "+a.key)
+	}
+}
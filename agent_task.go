@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// 等待下次上报期间领取任务的间隔
+const taskPollInterval = time.Minute
+
+// 上传日志时只上传末尾部分
+const uploadLogSize = 512 << 10
+
+// 领取任务
+func (a *agent) pollTasks() ([]AgentTask, error) {
+	resp, err := a.do(http.MethodGet, "/tasks?"+a.taskQuery(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tasks []AgentTask
+	if err := json.NewDecoder(resp.Body).Decode(&tasks); err != nil {
+		return nil, fmt.Errorf("任务解析失败: %v", err)
+	}
+	return tasks, nil
+}
+
+func (a *agent) ackTask(ack TaskAck) {
+	body, _ := json.Marshal(ack)
+	resp, err := a.do(http.MethodPost, "/tasks/ack?"+a.taskQuery(), body)
+	if err != nil {
+		log.Printf("【Client】 确认任务 #%d 失败: %v\n", ack.ID, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func (a *agent) taskQuery() string {
+	return url.Values{"host_id": {a.hostID}, "agent_id": {getAgentID()}}.Encode()
+}
+
+// 等待下次上报，期间定期领取并执行任务，收到采集任务时提前结束等待
+func (a *agent) wait(d time.Duration) {
+	deadline := time.Now().Add(d)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+		if a.tasksUnsupported || a.hostID == "" || a.serverURL == "" {
+			time.Sleep(remaining)
+			return
+		}
+		time.Sleep(min(jitter(taskPollInterval, intervalJitter), remaining))
+
+		tasks, err := a.pollTasks()
+		var statusErr *reportStatusError
+		if errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound {
+			log.Println("【Client】", "服务端不支持任务，停止领取")
+			a.tasksUnsupported = true
+			continue
+		}
+		if err != nil {
+			logDebug("【Client】", "领取任务失败:", err)
+			continue
+		}
+		if a.runTasks(tasks) {
+			return
+		}
+	}
+}
+
+// 执行任务，采集任务在下次上报后确认，返回是否需要立即采集
+func (a *agent) runTasks(tasks []AgentTask) bool {
+	collect := false
+	for _, t := range tasks {
+		log.Printf("【Client】 收到任务 #%d: %v\n", t.ID, t.Type)
+		switch t.Type {
+		case taskCollect, taskCollectFull:
+			a.collectTasks = append(a.collectTasks, t.ID)
+			a.fullCollect = a.fullCollect || t.Type == taskCollectFull
+			collect = true
+		case taskUploadLogs:
+			logs, err := readLogTail(uploadLogSize)
+			if err != nil {
+				a.ackTask(TaskAck{ID: t.ID, Status: taskFailed, Result: err.Error()})
+			} else {
+				a.ackTask(TaskAck{ID: t.ID, Status: taskDone, Result: logs})
+			}
+		case taskSetInterval:
+			var p struct {
+				Interval int `json:"interval"`
+			}
+			if err := json.Unmarshal(t.Params, &p); err != nil || p.Interval <= 0 {
+				a.ackTask(TaskAck{ID: t.ID, Status: taskFailed, Result: "参数格式错误"})
+				continue
+			}
+			cfg := a.config
+			cfg.Interval = p.Interval
+			a.updateConfig(cfg)
+			a.ackTask(TaskAck{ID: t.ID, Status: taskDone, Result: fmt.Sprintf("上报间隔已修改为 %d 分钟", p.Interval)})
+		default:
+			a.ackTask(TaskAck{ID: t.ID, Status: taskFailed, Result: "不支持的任务类型"})
+		}
+	}
+	return collect
+}
+
+// 上报后确认采集任务
+func (a *agent) ackCollectTasks(err error) {
+	for _, id := range a.collectTasks {
+		if err != nil {
+			a.ackTask(TaskAck{ID: id, Status: taskFailed, Result: err.Error()})
+		} else {
+			a.ackTask(TaskAck{ID: id, Status: taskDone, Result: "上报成功"})
+		}
+	}
+	a.collectTasks, a.fullCollect = nil, false
+}
+
+// 当前日志文件的末尾部分
+func readLogTail(size int64) (string, error) {
+	f, err := os.Open(logFilePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.Size() > size {
+		if _, err := f.Seek(-size, io.SeekEnd); err != nil {
+			return "", err
+		}
+	}
+	b, err := io.ReadAll(f)
+	return string(b), err
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 查询接口的版本前缀，接口不兼容变更时增加新版本，旧版本保留
+const apiPrefix = "/api/v1"
+
+const (
+	apiDefaultPageSize = 50
+	apiMaxPageSize     = 500
+	apiMaxBodySize     = 1 << 20
+	apiTaskLimit       = 50 // 主机详情中显示的最近任务数
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// 客户端上报间隔，超过该时间未上报视为离线
+var onlineInterval time.Duration
+
+// 错误响应，code 为固定的英文标识，message 为说明
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// 列表响应
+type apiList[T any] struct {
+	Total    int `json:"total"`
+	Page     int `json:"page,omitempty"`
+	PageSize int `json:"page_size,omitempty"`
+	Items    []T `json:"items"`
+}
+
+// 主机列表中的一项，不含软件、网卡等明细
+type HostSummary struct {
+	HostID       string   `json:"host_id"`
+	AgentID      string   `json:"agent_id"`
+	IdentityFlag string   `json:"identity_flag,omitempty"`
+	Hostname     string   `json:"hostname"`
+	Username     string   `json:"username"`
+	OS           string   `json:"os"`
+	CPU          string   `json:"cpu"`
+	MemoryTotal  ByteSize `json:"memory_total"`
+	DiskTotal    ByteSize `json:"disk_total"`
+	IPAddresses  []string `json:"ip_addresses"`
+	Updated      string   `json:"updated"`
+	Endpoint     string   `json:"endpoint,omitempty"`
+	AgentVersion string   `json:"agent_version,omitempty"`
+	Online       bool     `json:"online"`
+}
+
+// 主机详情
+type HostDetail struct {
+	ClientInfo
+	Online bool `json:"online"`
+}
+
+// 主机列表的筛选和排序条件
+type hostQuery struct {
+	Q        string // 匹配 HostID、主机名或用户名
+	Hostname string
+	OS       string
+	IP       string
+	Flag     string
+	Online   string // true / false，为空时不筛选
+	Sort     string
+	Desc     bool
+	Page     int
+	PageSize int
+}
+
+// 可排序的字段及对应的列
+var hostSortColumns = map[string]string{
+	"host_id":      "host_id",
+	"hostname":     "hostname COLLATE NOCASE",
+	"username":     "username COLLATE NOCASE",
+	"os":           "os COLLATE NOCASE",
+	"memory_total": "memory_total",
+	"disk_total":   "disk_total",
+	"updated":      "julianday(updated)",
+}
+
+func registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+apiPrefix+"/openapi.json", handleOpenAPI)
+	mux.HandleFunc("GET "+apiPrefix+"/hosts", authorize(roleViewer, handleListHosts))
+	mux.HandleFunc("GET "+apiPrefix+"/hosts/{id}", authorize(roleViewer, handleGetHost))
+	mux.HandleFunc("GET "+apiPrefix+"/hosts/{id}/programs", authorize(roleViewer, handleHostPrograms))
+	mux.HandleFunc("GET "+apiPrefix+"/hosts/{id}/interfaces", authorize(roleViewer, handleHostInterfaces))
+	mux.HandleFunc("GET "+apiPrefix+"/hosts/{id}/history", authorize(roleViewer, handleHostHistory))
+	mux.HandleFunc("GET "+apiPrefix+"/hosts/{id}/events", authorize(roleViewer, handleHostEvents))
+	mux.HandleFunc("GET "+apiPrefix+"/hosts/{id}/tasks", authorize(roleViewer, handleHostTasks))
+	mux.HandleFunc("POST "+apiPrefix+"/hosts/export", authorize(roleViewer, handleExportHosts))
+	registerAuthAPI(mux)
+	registerAdminAPI(mux)
+	// 其余路径返回 JSON 格式的错误，而不是默认的纯文本
+	mux.HandleFunc("/api/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "接口不存在: "+r.Method+" "+r.URL.Path)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("【Server】", "写入响应失败:", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, struct {
+		Error apiError `json:"error"`
+	}{apiError{code, message}})
+}
+
+// 数据库错误只记录日志，不在响应中暴露细节
+func writeDBError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "记录不存在")
+		return
+	}
+	log.Println("【Server】", "查询失败:", err)
+	writeAPIError(w, http.StatusInternalServerError, "internal", "查询失败")
+}
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(openAPISpec)
+}
+
+// 解析分页参数，page 从 1 开始
+func parsePage(r *http.Request) (page, pageSize int, err error) {
+	page, pageSize = 1, apiDefaultPageSize
+	if s := r.URL.Query().Get("page"); s != "" {
+		if page, err = strconv.Atoi(s); err != nil || page < 1 {
+			return 0, 0, fmt.Errorf("page 应为正整数: %q", s)
+		}
+	}
+	if s := r.URL.Query().Get("page_size"); s != "" {
+		if pageSize, err = strconv.Atoi(s); err != nil || pageSize < 1 || pageSize > apiMaxPageSize {
+			return 0, 0, fmt.Errorf("page_size 应为 1 到 %d 之间的整数: %q", apiMaxPageSize, s)
+		}
+	}
+	return page, pageSize, nil
+}
+
+func parseHostQuery(r *http.Request) (hostQuery, error) {
+	v := r.URL.Query()
+	q := hostQuery{
+		Q:        v.Get("q"),
+		Hostname: v.Get("hostname"),
+		OS:       v.Get("os"),
+		IP:       v.Get("ip"),
+		Flag:     v.Get("flag"),
+		Online:   v.Get("online"),
+		Sort:     v.Get("sort"),
+		Desc:     true,
+	}
+	var err error
+	if q.Page, q.PageSize, err = parsePage(r); err != nil {
+		return q, err
+	}
+	if q.Sort == "" {
+		q.Sort = "updated"
+	}
+	if _, ok := hostSortColumns[q.Sort]; !ok {
+		return q, fmt.Errorf("不支持按 %q 排序", q.Sort)
+	}
+	switch v.Get("order") {
+	case "asc":
+		q.Desc = false
+	case "", "desc":
+	default:
+		return q, fmt.Errorf("order 应为 asc 或 desc: %q", v.Get("order"))
+	}
+	switch q.Online {
+	case "", "true", "false":
+	default:
+		return q, fmt.Errorf("online 应为 true 或 false: %q", q.Online)
+	}
+	return q, nil
+}
+
+// 按条件查询主机，返回当前页和符合条件的总数
+func queryHosts(q hostQuery) ([]ClientInfo, int, error) {
+	var where []string
+	var args []any
+	like := func(s string) string {
+		s = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+		return "%" + s + "%"
+	}
+	if q.Q != "" {
+		where = append(where, `(host_id LIKE ? ESCAPE '\' OR hostname LIKE ? ESCAPE '\' OR username LIKE ? ESCAPE '\')`)
+		args = append(args, like(q.Q), like(q.Q), like(q.Q))
+	}
+	if q.Hostname != "" {
+		where = append(where, `hostname LIKE ? ESCAPE '\'`)
+		args = append(args, like(q.Hostname))
+	}
+	if q.OS != "" {
+		where = append(where, `os LIKE ? ESCAPE '\'`)
+		args = append(args, like(q.OS))
+	}
+	if q.IP != "" {
+		where = append(where, `ip_addresses LIKE ? ESCAPE '\'`)
+		args = append(args, like(q.IP))
+	}
+	if q.Flag != "" {
+		where = append(where, "identity_flag = ?")
+		args = append(args, q.Flag)
+	}
+	if q.Online != "" {
+		// updated 可能带时区偏移，按 julianday 比较
+		op := ">="
+		if q.Online == "false" {
+			op = "<"
+		}
+		where = append(where, "julianday(updated) "+op+" julianday(?)")
+		args = append(args, time.Now().Add(-onlineInterval).UTC().Format(time.RFC3339))
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM client_info"+cond, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("查询记录总数失败: %v", err)
+	}
+
+	order := hostSortColumns[q.Sort]
+	if q.Desc {
+		order += " DESC"
+	}
+	rows, err := db.Query(`SELECT `+clientInfoColumns+` FROM client_info`+cond+
+		` ORDER BY `+order+`, host_id LIMIT ? OFFSET ?`,
+		append(args, q.PageSize, (q.Page-1)*q.PageSize)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询主机失败: %v", err)
+	}
+	defer rows.Close()
+	var clients []ClientInfo
+	for rows.Next() {
+		c, err := scanClientInfo(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("查询主机解析错误: %v", err)
+		}
+		clients = append(clients, c)
+	}
+	return clients, total, rows.Err()
+}
+
+// 最后上报时间在上报间隔内视为在线
+func isOnline(updated string) bool {
+	t, err := time.Parse(time.RFC3339, updated)
+	return err == nil && time.Since(t) <= onlineInterval
+}
+
+func handleListHosts(w http.ResponseWriter, r *http.Request) {
+	q, err := parseHostQuery(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+	clients, total, err := queryHosts(q)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	audit(r, auditList, "", r.URL.RawQuery)
+	list := apiList[HostSummary]{Total: total, Page: q.Page, PageSize: q.PageSize, Items: []HostSummary{}}
+	for _, c := range clients {
+		list.Items = append(list.Items, HostSummary{
+			HostID:       c.HostID,
+			AgentID:      c.AgentID,
+			IdentityFlag: c.IdentityFlag,
+			Hostname:     c.Hostname,
+			Username:     c.Username,
+			OS:           c.OS,
+			CPU:          c.CPU,
+			MemoryTotal:  c.MemoryTotal,
+			DiskTotal:    c.DiskTotal,
+			IPAddresses:  c.IPAddresses,
+			Updated:      c.Updated,
+			Endpoint:     c.Endpoint,
+			AgentVersion: c.AgentVersion,
+			Online:       isOnline(c.Updated),
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// 按路径中的 HostID 查询，失败时写入错误响应；查看操作记录到审计日志
+func apiHost(w http.ResponseWriter, r *http.Request) (ClientInfo, bool) {
+	c, err := queryClientInfo(r.PathValue("id"))
+	if err != nil {
+		writeDBError(w, err)
+		return c, false
+	}
+	if r.Method == http.MethodGet {
+		audit(r, auditView, c.HostID, r.URL.Path)
+	}
+	return c, true
+}
+
+func handleGetHost(w http.ResponseWriter, r *http.Request) {
+	if c, ok := apiHost(w, r); ok {
+		writeJSON(w, http.StatusOK, HostDetail{c, isOnline(c.Updated)})
+	}
+}
+
+func handleHostPrograms(w http.ResponseWriter, r *http.Request) {
+	c, ok := apiHost(w, r)
+	if !ok {
+		return
+	}
+	programs := c.Programs
+	if name := strings.ToLower(r.URL.Query().Get("name")); name != "" {
+		programs = nil
+		for _, p := range c.Programs {
+			if strings.Contains(strings.ToLower(p.Name), name) {
+				programs = append(programs, p)
+			}
+		}
+	}
+	if programs == nil {
+		programs = ProgramList{}
+	}
+	writeJSON(w, http.StatusOK, apiList[Program]{Total: len(programs), Items: programs})
+}
+
+func handleHostInterfaces(w http.ResponseWriter, r *http.Request) {
+	c, ok := apiHost(w, r)
+	if !ok {
+		return
+	}
+	items := c.Interfaces
+	if items == nil {
+		items = []NetInterface{}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		apiList[NetInterface]
+		Gateways   []string `json:"gateways"`
+		DNSServers []string `json:"dns_servers"`
+	}{apiList[NetInterface]{Total: len(items), Items: items}, c.Gateways, c.DNSServers})
+}
+
+func handleHostHistory(w http.ResponseWriter, r *http.Request) {
+	if _, ok := apiHost(w, r); !ok {
+		return
+	}
+	page, pageSize, err := parsePage(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+	hostID := r.PathValue("id")
+	total, err := queryHostHistoryTotal(hostID)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	snapshots, err := queryHostHistory(hostID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if snapshots == nil {
+		snapshots = []HostSnapshot{}
+	}
+	writeJSON(w, http.StatusOK, apiList[HostSnapshot]{Total: total, Page: page, PageSize: pageSize, Items: snapshots})
+}
+
+func handleHostEvents(w http.ResponseWriter, r *http.Request) {
+	if _, ok := apiHost(w, r); !ok {
+		return
+	}
+	page, pageSize, err := parsePage(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+	hostID := r.PathValue("id")
+	total, err := queryHostEventsTotal(hostID)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	events, err := queryHostEvents(hostID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if events == nil {
+		events = []HostEvent{}
+	}
+	writeJSON(w, http.StatusOK, apiList[HostEvent]{Total: total, Page: page, PageSize: pageSize, Items: events})
+}
+
+// 解析 JSON 请求体，失败时写入错误响应
+func readAPIBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := readBody(w, r, apiMaxBodySize)
+	if err == nil {
+		err = json.Unmarshal(body, v)
+	}
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_body", "请求体格式错误: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func handleHostTasks(w http.ResponseWriter, r *http.Request) {
+	if _, ok := apiHost(w, r); !ok {
+		return
+	}
+	tasks, err := queryTasks(r.PathValue("id"), apiTaskLimit)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	if tasks == nil {
+		tasks = []AgentTask{}
+	}
+	writeJSON(w, http.StatusOK, apiList[AgentTask]{Total: len(tasks), Items: tasks})
+}
+
+// 导出指定主机为 xlsx
+func handleExportHosts(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		HostIDs []string `json:"host_ids"`
+	}
+	if !readAPIBody(w, r, &req) {
+		return
+	}
+	if len(req.HostIDs) == 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", "未指定任何主机")
+		return
+	}
+	var clients []ClientInfo
+	for _, id := range req.HostIDs {
+		c, err := queryClientInfo(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue // 导出期间被合并的记录
+		}
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		clients = append(clients, c)
+	}
+	for _, c := range clients {
+		audit(r, auditExport, c.HostID, "")
+	}
+	f := exportHostsWorkbook(clients)
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.xlsx"`)
+	if err := f.Write(w); err != nil {
+		log.Println("【Server】", "导出失败:", err)
+	}
+}
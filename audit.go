@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 审计日志的操作类型
+const (
+	auditList        = "list"       // 查询主机列表，detail 为查询条件
+	auditView        = "view"       // 查看主机详情、软件、网卡、历史等
+	auditExport      = "export"     // 导出
+	auditMerge       = "merge"      // 合并记录，host_id 为被合并的记录
+	auditSplit       = "split"      // 从记录中拆分出 agent，host_id 为原记录
+	auditClearFlag   = "clear_flag" // 清除身份异常标记
+	auditTask        = "task"       // 下发任务
+	auditDelete      = "delete"     // 删除记录
+	auditLogin       = "login"
+	auditLoginFailed = "login_failed"
+	auditPassword    = "password" // 修改自己的密码
+	auditToken       = "token"    // 创建、删除 API 令牌
+	auditUser        = "user"     // 管理用户
+)
+
+// 谁在什么时间对哪台主机做了什么
+type AuditEntry struct {
+	ID         int64  `json:"id"`
+	Time       string `json:"time"`
+	Username   string `json:"username"`
+	Action     string `json:"action"`
+	HostID     string `json:"host_id,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+}
+
+// 记录当前请求的用户的操作，写入失败只记录日志，不影响操作本身
+func audit(r *http.Request, action, hostID, detail string) {
+	writeAudit(currentUser(r).Username, action, hostID, detail, r.RemoteAddr)
+}
+
+// 界面和命令行的操作以 gui、cli 作为用户名
+func writeAudit(username, action, hostID, detail, remoteAddr string) {
+	_, err := db.Exec("INSERT INTO audit_log (time, username, action, host_id, detail, remote_addr) VALUES (?,?,?,?,?,?)",
+		time.Now().Format(time.RFC3339), username, action, hostID, detail, remoteAddr)
+	if err != nil {
+		log.Println("【Server】", "写入审计日志失败:", err)
+	}
+}
+
+// 按条件分页查询审计日志，按时间倒序
+func queryAuditLog(hostID, username, action string, limit, offset int) ([]AuditEntry, int, error) {
+	var where []string
+	var args []any
+	for _, f := range []struct{ col, value string }{{"host_id", hostID}, {"username", username}, {"action", action}} {
+		if f.value != "" {
+			where = append(where, f.col+" = ?")
+			args = append(args, f.value)
+		}
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = " WHERE " + strings.Join(where, " AND ")
+	}
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_log"+cond, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := db.Query("SELECT id, time, username, action, host_id, detail, remote_addr FROM audit_log"+cond+
+		" ORDER BY id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		if err := rows.Scan(&e.ID, &e.Time, &e.Username, &e.Action, &e.HostID, &e.Detail, &e.RemoteAddr); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+func handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	page, pageSize, err := parsePage(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+	v := r.URL.Query()
+	entries, total, err := queryAuditLog(v.Get("host_id"), v.Get("username"), v.Get("action"), pageSize, (page-1)*pageSize)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiList[AuditEntry]{Total: total, Page: page, PageSize: pageSize, Items: entries})
+}
@@ -0,0 +1,642 @@
+package main
+
+import (
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 查询接口和网页界面的用户角色，admin 拥有 viewer 的全部权限
+const (
+	roleViewer = "viewer" // 查看和导出
+	roleAdmin  = "admin"  // 合并、删除记录，下发任务，管理用户和查看审计日志
+)
+
+var allRoles = []string{roleViewer, roleAdmin}
+
+const (
+	sessionCookie      = "cic_session"
+	sessionLifetime    = 12 * time.Hour
+	apiTokenPrefix     = "cic_" // 便于在日志、配置中识别泄露的令牌
+	passwordIterations = 600000
+	minPasswordLength  = 8
+
+	initialPasswordFile = "initial_admin_password" // 首次启动时生成的管理员密码
+)
+
+var (
+	errInvalidLogin = errors.New("用户名或密码错误")
+	errLastAdmin    = errors.New("至少需要保留一个管理员")
+)
+
+// 用户账号
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Created  string `json:"created"`
+}
+
+// 用户的 API 令牌，只保存哈希，创建时返回一次明文
+type APIToken struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Created  string `json:"created"`
+	LastUsed string `json:"last_used,omitempty"`
+	Token    string `json:"token,omitempty"`
+}
+
+// 格式为 pbkdf2-sha256$迭代次数$盐$哈希
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations, hex.EncodeToString(salt), hex.EncodeToString(key)), nil
+}
+
+func checkPassword(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	salt, err1 := hex.DecodeString(parts[2])
+	want, err2 := hex.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	return err == nil && subtle.ConstantTimeCompare(key, want) == 1
+}
+
+func validateUser(username, password, role string) error {
+	if username == "" || strings.ContainsAny(username, ", \t/") {
+		return fmt.Errorf("用户名不能为空，且不能包含逗号、空格和斜杠")
+	}
+	if password != "" && len(password) < minPasswordLength {
+		return fmt.Errorf("密码至少 %d 位", minPasswordLength)
+	}
+	if role != "" && !slices.Contains(allRoles, role) {
+		return fmt.Errorf("未知的角色: %v，可选 %v", role, strings.Join(allRoles, "、"))
+	}
+	return nil
+}
+
+func addUser(username, password, role string) (User, error) {
+	if err := validateUser(username, password, role); err != nil {
+		return User{}, err
+	}
+	if password == "" || role == "" {
+		return User{}, fmt.Errorf("需要指定密码和角色")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	u := User{Username: username, Role: role, Created: time.Now().Format(time.RFC3339)}
+	res, err := db.Exec("INSERT INTO app_user (username, password_hash, role, created) VALUES (?,?,?,?)",
+		u.Username, hash, u.Role, u.Created)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return User{}, fmt.Errorf("用户 %v 已存在", username)
+		}
+		return User{}, err
+	}
+	u.ID, err = res.LastInsertId()
+	return u, err
+}
+
+// 修改密码或角色，参数为空时不修改；修改密码后已登录的会话失效
+func updateUser(username, password, role string) error {
+	if err := validateUser(username, password, role); err != nil {
+		return err
+	}
+	u, err := queryUser(username)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if role != "" && role != u.Role {
+		if u.Role == roleAdmin {
+			if err := checkOtherAdmin(tx, u.ID); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("UPDATE app_user SET role = ? WHERE id = ?", role, u.ID); err != nil {
+			return err
+		}
+	}
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE app_user SET password_hash = ? WHERE id = ?", hash, u.ID); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM user_session WHERE user_id = ?", u.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 删除用户及其会话和令牌
+func deleteUser(username string) error {
+	u, err := queryUser(username)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if u.Role == roleAdmin {
+		if err := checkOtherAdmin(tx, u.ID); err != nil {
+			return err
+		}
+	}
+	for _, query := range []string{
+		"DELETE FROM user_session WHERE user_id = ?",
+		"DELETE FROM api_token WHERE user_id = ?",
+		"DELETE FROM app_user WHERE id = ?",
+	} {
+		if _, err := tx.Exec(query, u.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func checkOtherAdmin(tx *sql.Tx, userID int64) error {
+	var n int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM app_user WHERE role = ? AND id != ?", roleAdmin, userID).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return errLastAdmin
+	}
+	return nil
+}
+
+const userColumns = `id, username, role, created`
+
+func queryUser(username string) (User, error) {
+	var u User
+	err := db.QueryRow(`SELECT `+userColumns+` FROM app_user WHERE username = ?`, username).Scan(&u.ID, &u.Username, &u.Role, &u.Created)
+	return u, err
+}
+
+func queryUsers() ([]User, error) {
+	rows, err := db.Query(`SELECT ` + userColumns + ` FROM app_user ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role, &u.Created); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func authenticatePassword(username, password string) (User, error) {
+	var u User
+	var hash string
+	err := db.QueryRow(`SELECT `+userColumns+`, password_hash FROM app_user WHERE username = ?`, username).
+		Scan(&u.ID, &u.Username, &u.Role, &u.Created, &hash)
+	if err == sql.ErrNoRows {
+		return u, errInvalidLogin
+	}
+	if err != nil {
+		return u, err
+	}
+	if !checkPassword(hash, password) {
+		return u, errInvalidLogin
+	}
+	return u, nil
+}
+
+// 新建会话，返回写入 Cookie 的令牌，数据库中只保存哈希
+func newSession(userID int64) (string, time.Time, error) {
+	token, err := newAgentKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	now := time.Now()
+	expires := now.Add(sessionLifetime)
+	// 顺便清理过期的会话
+	if _, err := db.Exec("DELETE FROM user_session WHERE expires < ?", now.Unix()); err != nil {
+		return "", time.Time{}, err
+	}
+	_, err = db.Exec("INSERT INTO user_session (token_hash, user_id, created, expires) VALUES (?,?,?,?)",
+		hashAgentKey(token), userID, now.Format(time.RFC3339), expires.Unix())
+	return token, expires, err
+}
+
+func deleteSession(token string) error {
+	_, err := db.Exec("DELETE FROM user_session WHERE token_hash = ?", hashAgentKey(token))
+	return err
+}
+
+func sessionUser(token string) (User, error) {
+	var u User
+	err := db.QueryRow(`SELECT u.id, u.username, u.role, u.created
+			FROM user_session s JOIN app_user u ON u.id = s.user_id
+			WHERE s.token_hash = ? AND s.expires >= ?`, hashAgentKey(token), time.Now().Unix()).
+		Scan(&u.ID, &u.Username, &u.Role, &u.Created)
+	return u, err
+}
+
+func newAPIToken(userID int64, name string) (APIToken, error) {
+	if strings.TrimSpace(name) == "" {
+		return APIToken{}, fmt.Errorf("需要指定令牌名称")
+	}
+	key, err := newAgentKey()
+	if err != nil {
+		return APIToken{}, err
+	}
+	t := APIToken{Name: name, Created: time.Now().Format(time.RFC3339), Token: apiTokenPrefix + key}
+	res, err := db.Exec("INSERT INTO api_token (user_id, name, token_hash, created) VALUES (?,?,?,?)",
+		userID, t.Name, hashAgentKey(t.Token), t.Created)
+	if err != nil {
+		return APIToken{}, err
+	}
+	t.ID, err = res.LastInsertId()
+	return t, err
+}
+
+func queryAPITokens(userID int64) ([]APIToken, error) {
+	rows, err := db.Query("SELECT id, name, created, last_used FROM api_token WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := []APIToken{}
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Created, &t.LastUsed); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func deleteAPIToken(userID, id int64) error {
+	res, err := db.Exec("DELETE FROM api_token WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func tokenUser(token string) (User, error) {
+	var u User
+	var id int64
+	err := db.QueryRow(`SELECT t.id, u.id, u.username, u.role, u.created
+			FROM api_token t JOIN app_user u ON u.id = t.user_id
+			WHERE t.token_hash = ?`, hashAgentKey(token)).
+		Scan(&id, &u.ID, &u.Username, &u.Role, &u.Created)
+	if err != nil {
+		return u, err
+	}
+	_, err = db.Exec("UPDATE api_token SET last_used = ? WHERE id = ?", time.Now().Format(time.RFC3339), id)
+	return u, err
+}
+
+// 首次启动时创建管理员 admin，随机密码写入数据目录下的文件
+func ensureAdminUser() error {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM app_user").Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return nil
+	}
+	password, err := newAgentKey()
+	if err != nil {
+		return err
+	}
+	if _, err := addUser("admin", password, roleAdmin); err != nil {
+		return err
+	}
+	if err := writeStateFile(initialPasswordFile, []byte(password+"\n")); err != nil {
+		return err
+	}
+	log.Printf("【Server】 已创建管理员 admin，初始密码见 %v，登录后请修改密码并删除该文件\n", filepath.Join(dataDir, initialPasswordFile))
+	return nil
+}
+
+type userContextKey struct{}
+
+// 已认证的用户，未认证时为空
+func currentUser(r *http.Request) User {
+	u, _ := r.Context().Value(userContextKey{}).(User)
+	return u
+}
+
+// 优先使用 API 令牌（Authorization: Bearer cic_...），其次为会话 Cookie
+func requestUser(r *http.Request) (User, error) {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return tokenUser(token)
+	}
+	c, err := r.Cookie(sessionCookie)
+	if err != nil {
+		return User{}, sql.ErrNoRows
+	}
+	return sessionUser(c.Value)
+}
+
+// 要求已登录且拥有指定角色
+func authorize(role string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u, err := requestUser(r)
+		if err == sql.ErrNoRows {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "未登录或登录已过期")
+			return
+		}
+		if err != nil {
+			writeDBError(w, err)
+			return
+		}
+		if role == roleAdmin && u.Role != roleAdmin {
+			writeAPIError(w, http.StatusForbidden, "forbidden", "需要管理员权限")
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, u)))
+	}
+}
+
+func registerAuthAPI(mux *http.ServeMux) {
+	mux.HandleFunc("POST "+apiPrefix+"/login", handleLogin)
+	mux.HandleFunc("POST "+apiPrefix+"/logout", handleLogout)
+	mux.HandleFunc("GET "+apiPrefix+"/me", authorize(roleViewer, handleMe))
+	mux.HandleFunc("POST "+apiPrefix+"/me/password", authorize(roleViewer, handleChangePassword))
+	mux.HandleFunc("GET "+apiPrefix+"/tokens", authorize(roleViewer, handleListTokens))
+	mux.HandleFunc("POST "+apiPrefix+"/tokens", authorize(roleViewer, handleAddToken))
+	mux.HandleFunc("DELETE "+apiPrefix+"/tokens/{id}", authorize(roleViewer, handleDeleteToken))
+	mux.HandleFunc("GET "+apiPrefix+"/users", authorize(roleAdmin, handleListUsers))
+	mux.HandleFunc("POST "+apiPrefix+"/users", authorize(roleAdmin, handleAddUser))
+	mux.HandleFunc("PATCH "+apiPrefix+"/users/{username}", authorize(roleAdmin, handleUpdateUser))
+	mux.HandleFunc("DELETE "+apiPrefix+"/users/{username}", authorize(roleAdmin, handleDeleteUser))
+}
+
+func handleLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if !readAPIBody(w, r, &req) {
+		return
+	}
+	u, err := authenticatePassword(req.Username, req.Password)
+	if err == errInvalidLogin {
+		writeAudit(req.Username, auditLoginFailed, "", "", r.RemoteAddr)
+		time.Sleep(time.Second) // 减缓暴力破解
+		writeAPIError(w, http.StatusUnauthorized, "unauthorized", err.Error())
+		return
+	}
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	token, expires, err := newSession(u.ID)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode, // 防止跨站请求伪造
+	})
+	writeAudit(u.Username, auditLogin, "", "", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, u)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if err := deleteSession(c.Value); err != nil {
+			log.Println("【Server】", "删除会话失败:", err)
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, currentUser(r))
+}
+
+func handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Old string `json:"old_password"`
+		New string `json:"new_password"`
+	}
+	if !readAPIBody(w, r, &req) {
+		return
+	}
+	u := currentUser(r)
+	if _, err := authenticatePassword(u.Username, req.Old); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", "原密码错误")
+		return
+	}
+	if req.New == "" {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", "需要指定新密码")
+		return
+	}
+	if err := updateUser(u.Username, req.New, ""); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+	audit(r, auditPassword, "", u.Username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleListTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := queryAPITokens(currentUser(r).ID)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiList[APIToken]{Total: len(tokens), Items: tokens})
+}
+
+func handleAddToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if !readAPIBody(w, r, &req) {
+		return
+	}
+	t, err := newAPIToken(currentUser(r).ID, req.Name)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+	audit(r, auditToken, "", "create "+t.Name)
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func handleDeleteToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", "令牌 ID 应为整数")
+		return
+	}
+	if err := deleteAPIToken(currentUser(r).ID, id); err != nil {
+		writeDBError(w, err)
+		return
+	}
+	audit(r, auditToken, "", "delete #"+r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := queryUsers()
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiList[User]{Total: len(users), Items: users})
+}
+
+type userRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+func handleAddUser(w http.ResponseWriter, r *http.Request) {
+	var req userRequest
+	if !readAPIBody(w, r, &req) {
+		return
+	}
+	u, err := addUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		return
+	}
+	audit(r, auditUser, "", "add "+u.Username+" "+u.Role)
+	writeJSON(w, http.StatusCreated, u)
+}
+
+func handleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	var req userRequest
+	if !readAPIBody(w, r, &req) {
+		return
+	}
+	username := r.PathValue("username")
+	if err := updateUser(username, req.Password, req.Role); err != nil {
+		if err == sql.ErrNoRows {
+			writeDBError(w, err)
+		} else {
+			writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		}
+		return
+	}
+	detail := "update " + username
+	if req.Role != "" {
+		detail += " role=" + req.Role
+	}
+	if req.Password != "" {
+		detail += " password"
+	}
+	audit(r, auditUser, "", detail)
+	u, err := queryUser(username)
+	if err != nil {
+		writeDBError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, u)
+}
+
+func handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	if err := deleteUser(username); err != nil {
+		if err == sql.ErrNoRows {
+			writeDBError(w, err)
+		} else {
+			writeAPIError(w, http.StatusBadRequest, "invalid_parameter", err.Error())
+		}
+		return
+	}
+	audit(r, auditUser, "", "delete "+username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 命令行新增用户或重置密码，参数格式为 "用户名,角色"，密码随机生成并输出
+func runUserCommand(arg string) {
+	if err := initDataBase(); err != nil {
+		log.Fatalln("【Server】", err)
+	}
+	defer closeDataBase()
+
+	username, role, _ := strings.Cut(arg, ",")
+	username, role = strings.TrimSpace(username), strings.TrimSpace(role)
+	password, err := newAgentKey()
+	if err != nil {
+		log.Fatalln("【Server】", err)
+	}
+	if _, err := queryUser(username); err == nil {
+		err = updateUser(username, password, role)
+		if err != nil {
+			log.Fatalln("【Server】", "修改用户失败:", err)
+		}
+		detail := "update " + username
+		if role != "" {
+			detail += " role=" + role
+		}
+		writeAudit("cli", auditUser, "", detail+" password", "")
+		fmt.Printf("已重置用户 %v 的密码: %v\n", username, password)
+		return
+	} else if err != sql.ErrNoRows {
+		log.Fatalln("【Server】", err)
+	}
+	if role == "" {
+		role = roleViewer
+	}
+	if _, err := addUser(username, password, role); err != nil {
+		log.Fatalln("【Server】", "新增用户失败:", err)
+	}
+	writeAudit("cli", auditUser, "", "add "+username+" "+role, "")
+	fmt.Printf("已新增用户 %v（%v），密码: %v\n", username, role, password)
+}
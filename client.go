@@ -2,14 +2,16 @@ package main
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"os"
-	"os/user"
-	"sort"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,120 +19,47 @@ import (
 	"github.com/shirou/gopsutil/v4/disk"
 	"github.com/shirou/gopsutil/v4/host"
 	"github.com/shirou/gopsutil/v4/mem"
-	"golang.org/x/sys/windows/registry"
 )
 
-func getIPAddresses() []string {
-	var ips []string
-	ifaces, err := net.Interfaces()
-	if err != nil {
-		log.Println("【Client】", "获取网络接口失败:", err)
-		ips = append(ips, "unknown")
-		return ips
-	}
-	for _, iface := range ifaces {
-		addrs, _ := iface.Addrs()
-		for _, addr := range addrs {
-			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() {
-				if ip4 := ipNet.IP.To4(); ip4 != nil {
-					ipStr := ip4.String()
-					// 过滤 169.254.x.x
-					if strings.HasPrefix(ipStr, "169.254.") {
-						continue
-					}
-					ips = append(ips, ipStr)
-				}
-			}
-		}
-	}
-	if len(ips) == 0 {
-		ips = append(ips, "unknown") // 防止数据库非空字段错误
-	}
-	return ips
-}
-
-func getMACAddresses() []string {
-	var macs []string
-	ifaces, err := net.Interfaces()
+// 分区列表，忽略 snap 等只读镜像，同一设备（如 btrfs 子卷、bind mount）只保留第一个挂载点
+func getVolumes() []Volume {
+	var volumes []Volume
+	partitions, err := disk.Partitions(false)
 	if err != nil {
-		log.Println("【Client】", "获取网络接口失败:", err)
-		macs = append(macs, "unknown")
-		return macs
+		fmt.Println("【Client】", "获取客户端信息出错:", err)
+		return volumes
 	}
-	for _, iface := range ifaces {
-		mac := iface.HardwareAddr.String()
-		if mac == "" {
+	seen := make(map[string]bool)
+	for _, p := range partitions {
+		if p.Fstype == "squashfs" || seen[p.Device] {
 			continue
 		}
-		if iface.Flags&net.FlagLoopback != 0 {
-			continue // 回环
-		}
-		if iface.Flags&net.FlagUp == 0 {
-			continue // 未连接
-		}
-		macs = append(macs, mac)
-	}
-	if len(macs) == 0 {
-		macs = append(macs, "unknown") // 防止数据库非空字段错误
-	}
-	return macs
-}
-
-func getPrograms() []string {
-	locations := []registry.Key{
-		registry.LOCAL_MACHINE,
-		registry.CURRENT_USER,
-	}
-	subPaths := []string{
-		`SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`,
-		`SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`,
-	}
-
-	var programs []string
-	for _, root := range locations {
-		for _, path := range subPaths {
-			k, err := registry.OpenKey(root, path, registry.READ)
-			if err != nil {
-				continue
-			}
-			defer k.Close()
-
-			names, err := k.ReadSubKeyNames(-1)
-			if err != nil {
-				continue
-			}
-
-			for _, name := range names {
-				subKey, err := registry.OpenKey(k, name, registry.READ)
-				if err != nil {
-					continue
-				}
-				defer subKey.Close()
-
-				displayName, _, err := subKey.GetStringValue("DisplayName")
-				if err == nil && displayName != "" {
-					programs = append(programs, displayName)
-				}
-			}
+		usage, err := disk.Usage(p.Mountpoint)
+		if err != nil {
+			continue
 		}
+		seen[p.Device] = true
+		volumes = append(volumes, Volume{
+			Mountpoint: p.Mountpoint,
+			Device:     p.Device,
+			Filesystem: p.Fstype,
+			Total:      ByteSize(usage.Total),
+			Used:       ByteSize(usage.Used),
+			Free:       ByteSize(usage.Free),
+		})
 	}
-	if len(programs) == 0 {
-		programs = append(programs, "unknown") // 防止数据库非空字段错误
-	} else {
-		sort.Strings(programs) // 按字母顺序排序
-	}
-	return programs
+	return volumes
 }
 
-// 收集客户端信息
-func collectClientInfo() *ClientInfo {
+// 收集客户端信息，cfg 中未启用的采集项不采集
+func collectClientInfo(cfg AgentConfig) *ClientInfo {
 	var hostId string = "unknown"
 	var hostname string = "unknown"
 	var osVersion string = "unknown"
 	var arch string = ""
 	var cpuModel string = "unknown"
-	var memV string = "unknown"
-	var diskSize string = "unknown"
+	var memTotal, memUsed, memFree uint64
+	var diskTotal, diskUsed, diskFree uint64
 	// 计算机名、操作系统
 	hostInfo, err := host.Info()
 	if err != nil {
@@ -138,17 +67,10 @@ func collectClientInfo() *ClientInfo {
 	} else {
 		hostId = hostInfo.HostID
 		hostname = hostInfo.Hostname
-		osVersion = hostInfo.Platform
+		osVersion = getOSVersion(hostInfo)
 		arch = hostInfo.KernelArch
 	}
 
-	// 用户名
-	currentUser, err := user.Current()
-	if err != nil {
-		currentUser = &user.User{Username: "unknown"}
-		fmt.Println("【Client】", "获取客户端信息出错:", err)
-	}
-
 	// cpu 型号
 	cpuInfo, err := cpu.Info()
 	if err == nil && len(cpuInfo) > 0 {
@@ -163,107 +85,388 @@ func collectClientInfo() *ClientInfo {
 		fmt.Println("【Client】", "获取客户端信息出错:", err)
 
 	} else {
-		memV = fmt.Sprintf("%.2f GB", float64(vmem.Total)/(1<<30))
+		memTotal = vmem.Total
+		memUsed = vmem.Used
+		memFree = vmem.Available
 	}
 
-	// 获取磁盘
-	partitions, err := disk.Partitions(false)
-	var diskTotal uint64
-	if err != nil {
-		fmt.Println("【Client】", "获取客户端信息出错:", err)
-	} else {
-		for _, p := range partitions {
-			usage, err := disk.Usage(p.Mountpoint)
-			if err != nil {
-				continue
-			}
-			diskTotal += usage.Total
-		}
-		if diskTotal >= (1 << 40) {
-			diskSize = fmt.Sprintf("%.2f TB", float64(diskTotal)/(1<<40))
-		} else {
-			diskSize = fmt.Sprintf("%.2f GB", float64(diskTotal)/(1<<30))
-		}
+	// 获取磁盘，同一设备多次挂载时只统计一次
+	volumes := getVolumes()
+	for _, v := range volumes {
+		diskTotal += uint64(v.Total)
+		diskUsed += uint64(v.Used)
+		diskFree += uint64(v.Free)
 	}
 
+	// 网卡
+	ifaces := getInterfaces()
+
 	client := &ClientInfo{
 		HostID:       hostId,
+		AgentID:      getAgentID(),
+		AgentVersion: appVersion,
+		Fingerprint:  getFingerprint(ifaces),
 		Hostname:     hostname,
-		Username:     currentUser.Username,
+		Username:     getUsername(),
 		OS:           fmt.Sprintf("%v %v", osVersion, arch),
 		CPU:          cpuModel,
-		Memory:       memV,
-		Disk:         diskSize,
-		IPAddresses:  getIPAddresses(),
-		MACAddresses: getMACAddresses(),
-		Programs:     getPrograms(),
+		MemoryTotal:  ByteSize(memTotal),
+		MemoryUsed:   ByteSize(memUsed),
+		MemoryFree:   ByteSize(memFree),
+		DiskTotal:    ByteSize(diskTotal),
+		DiskUsed:     ByteSize(diskUsed),
+		DiskFree:     ByteSize(diskFree),
+		Volumes:      volumes,
 		Updated:      time.Now().Format(time.RFC3339),
 	}
+	if cfg.collectorEnabled(collectorDisks) {
+		client.PhysicalDisks = getPhysicalDisks()
+	} else {
+		client.Skipped = append(client.Skipped, collectorDisks)
+	}
+	if cfg.collectorEnabled(collectorNetwork) {
+		client.Interfaces = ifaces
+		client.Gateways = getGateways()
+		client.DNSServers = getDNSServers()
+		client.IPAddresses = ipAddressesOf(ifaces)
+		client.MACAddresses = macAddressesOf(ifaces)
+	} else {
+		client.Skipped = append(client.Skipped, collectorNetwork)
+	}
+	if cfg.collectorEnabled(collectorPrograms) {
+		client.Programs = getPrograms()
+	} else {
+		client.Skipped = append(client.Skipped, collectorPrograms)
+	}
 
 	return client
 }
 
-// 发送数据
-func sendToServer(info *ClientInfo, serverURL string) error {
+// 服务端拒绝客户端认证
+var errUnauthorized = errors.New("服务端拒绝客户端认证")
 
-	if !testServer(serverURL) {
-		return fmt.Errorf("无法连接到服务端: %v", serverURL)
-	}
+// 连接服务端失败（网络不通、超时等）
+var errServerUnreachable = errors.New("无法连接到服务端")
+
+// 服务端返回的错误状态
+type reportStatusError struct {
+	code       int
+	status     string
+	retryAfter time.Duration // 服务端要求的重试等待时间
+}
+
+func (e *reportStatusError) Error() string {
+	return fmt.Sprintf("发送成功，但服务端返回: %v", e.status)
+}
+
+// 数据本身无效，重试也不会成功
+func (e *reportStatusError) permanent() bool {
+	return e.code == http.StatusBadRequest || e.code == http.StatusRequestEntityTooLarge
+}
 
-	data, err := json.Marshal(info)
+// 向服务端发送请求，附带客户端密钥和签名
+// 返回的响应状态一定为 200，其他状态转换为错误
+func (a *agent) do(method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, a.serverURL+path, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("JSON 解析失败: %v", err)
+		return nil, err
 	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	a.apiKey.authorize(req)
+	if err := signReport(req, a.signKey, body); err != nil {
+		return nil, fmt.Errorf("签名失败: %v", err)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errServerUnreachable, err)
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp, nil
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, errUnauthorized
+	}
+	return nil, &reportStatusError{
+		code:       resp.StatusCode,
+		status:     resp.Status,
+		retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
 
-	resp, err := http.Post(serverURL+"/report", "application/json", bytes.NewBuffer(data))
+// 发送数据，返回服务端下发的配置（旧版服务端不下发时为 nil）
+func (a *agent) sendToServer(info *ClientInfo) (*AgentConfig, error) {
+	sent := *info
+	sent.Endpoint = a.serverURL // 记录接收数据的服务端，缓存的数据补报时为实际补报的服务端
+	data, err := json.Marshal(sent)
 	if err != nil {
-		return fmt.Errorf("发送 Post 请求失败: %v", err)
+		return nil, fmt.Errorf("JSON 解析失败: %v", err)
+	}
+	resp, err := a.do(http.MethodPost, "/report", data)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("发送成功，但服务端返回: %v", resp.Status)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return nil, nil
 	}
-	return nil
+	var cfg AgentConfig
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		log.Println("【Client】", "服务端下发的配置解析失败:", err)
+		return nil, nil
+	}
+	return &cfg, nil
 }
 
-// 测试连接
-func testServer(url string) bool {
-	client := http.Client{
-		Timeout: 3 * time.Second,
-	}
-	resp, err := client.Get(url)
-	if err == nil {
-		resp.Body.Close()
-	}
-	return err == nil
+const agentConfigFile = "agent_config.json"
+
+// 客户端运行状态
+type agent struct {
+	opts      ClientOptions
+	scheme    string
+	client    *http.Client
+	cert      *agentCertificate
+	apiKey    *agentAPIKey
+	signKey   ed25519.PrivateKey
+	spool     *reportSpool
+	scheduler *reportScheduler
+	config    AgentConfig // 服务端下发的配置，优先于启动参数
+	servers   *serverPool
+	serverURL string // 当前请求的服务端
+	hostID    string // 最近一次采集的 HostID，领取任务时使用
+
+	discovered bool // 服务端列表为自动发现的地址，全部连接失败时重新发现
+
+	collectTasks     []int64 // 等待上报后确认的采集任务
+	fullCollect      bool    // 下次采集忽略关闭的采集项
+	tasksUnsupported bool    // 旧版服务端没有任务接口
 }
 
 // 启动客户端
-func startClient(port int, ip string, interval int) {
+func startClient(opts ClientOptions) {
 	log.Println("【Client】", "启动中 ...")
-	serverURL := fmt.Sprintf("http://%s:%d", ip, port)
+	apiKey := newAgentAPIKey(opts.EnrollToken)
+	a := &agent{
+		opts:      opts,
+		scheme:    "http",
+		cert:      &agentCertificate{token: apiKey.token},
+		apiKey:    apiKey,
+		spool:     newReportSpool(),
+		scheduler: newReportScheduler(opts.Interval),
+	}
+	// 不再单独探测服务端，由各阶段超时控制单次请求
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	a.client = &http.Client{Transport: transport, Timeout: time.Minute}
+	var err error
+	a.signKey, err = loadSignKey()
+	if err != nil {
+		log.Fatalln("【Client】", "加载签名密钥失败:", err)
+	}
+	if opts.TLS {
+		tlsConfig, err := loadClientTLSConfig(opts)
+		if err != nil {
+			log.Fatalln("【Client】", err)
+		}
+		if opts.MTLS {
+			tlsConfig.GetClientCertificate = a.cert.getClientCertificate
+		}
+		a.scheme = "https"
+		transport.TLSClientConfig = tlsConfig
+	}
+	if len(opts.Servers) == 0 {
+		a.opts.Servers = parseServerList(readStateFile(serversFile))
+	}
+	// 上次保存的服务端配置
+	var saved AgentConfig
+	if text := readStateFile(agentConfigFile); text != "" {
+		if err := json.Unmarshal([]byte(text), &saved); err != nil {
+			log.Println("【Client】", "本地配置解析失败:", err)
+		}
+	}
+	a.applyConfig(saved)
+	a.run()
+}
+
+func (a *agent) run() {
+	// 只执行一次时不延迟
+	if delay := a.scheduler.initialDelay(); delay > 0 && a.opts.Interval > 0 {
+		logInfo("【Client】", fmt.Sprintf("%v 后开始上报", delay.Round(time.Second)))
+		time.Sleep(delay)
+	}
 
 	for {
 		// 收集系统信息
-		info := collectClientInfo()
+		cfg := a.config
+		if a.fullCollect {
+			cfg.Collectors = nil
+		}
+		info := collectClientInfo(cfg)
+		a.hostID = info.HostID
 
-		// 发送数据失败并不终止程序
-		err := sendToServer(info, serverURL)
+		// 先按顺序补报离线期间缓存的数据
+		n, err := a.spool.flush(a.report)
+		if n > 0 {
+			logInfo("【Client】", fmt.Sprintf("补报离线缓存数据 %d 条", n))
+		}
+		if err == nil {
+			err = a.report(info)
+		}
+		// 发送数据失败并不终止程序，数据缓存到本地
+		var statusErr *reportStatusError
 		if err != nil {
 			log.Println("【Client】", err)
+			if !errors.As(err, &statusErr) || !statusErr.permanent() {
+				if err := a.spool.push(info); err != nil {
+					log.Println("【Client】", "缓存数据失败:", err)
+				}
+			}
 		} else {
-			log.Println("【Client】", "发送数据成功")
+			logInfo("【Client】", "发送数据成功")
 		}
+		a.ackCollectTasks(err)
 
 		// 只执行一次
-		if interval == 0 {
+		if a.opts.Interval == 0 {
 			log.Println("【Client】", "执行一次成功，退出程序")
 			os.Exit(1)
 		}
 
-		// 每 interval 分钟发送一次
-		time.Sleep(time.Duration(interval) * time.Minute)
+		// 按上报间隔等待，失败时退避
+		delay := a.scheduler.next(err)
+		if err != nil {
+			logInfo("【Client】", fmt.Sprintf("%v 后重试", delay.Round(time.Second)))
+		}
+		a.wait(delay)
+	}
+}
+
+// 上报一条数据，必要时先查找服务端，当前服务端不可用时依次尝试其他服务端
+func (a *agent) report(info *ClientInfo) error {
+	if a.servers.empty() {
+		urls, err := discoverServer(a.scheme, a.opts.Port)
+		if err != nil {
+			return err
+		}
+		a.servers = newServerPool(urls)
+		if err := writeStateFile(discoveredServerFile, []byte(strings.Join(urls, "\n"))); err != nil {
+			log.Println("【Client】", "缓存服务端地址失败:", err)
+		}
+	}
+
+	var err error
+	for _, e := range a.servers.candidates() {
+		a.serverURL = e.url
+		err = a.reportTo(info)
+		if !shouldFailover(err) {
+			if err == nil {
+				a.servers.success(e)
+			}
+			break
+		}
+		a.servers.failure(e)
+		logDebug("【Client】", "服务端不可用:", e.url, err)
+	}
+	a.serverURL = a.servers.active()
+
+	// 发现的服务端都不可用时清除缓存，下次上报前重新发现
+	if shouldFailover(err) && a.discovered {
+		os.Remove(filepath.Join(dataDir, discoveredServerFile))
+		a.servers = newServerPool(nil)
+		a.serverURL = ""
+	}
+	return err
+}
+
+// 向当前服务端上报，必要时先注册，并应用服务端下发的配置
+func (a *agent) reportTo(info *ClientInfo) error {
+	var err error
+	if a.opts.MTLS {
+		err = a.cert.ensure(a.client, a.serverURL)
+	}
+	if err == nil && a.apiKey.enabled() {
+		err = a.apiKey.ensure(a.client, a.serverURL)
+	}
+	if err != nil {
+		return err
+	}
+	cfg, err := a.sendToServer(info)
+	if errors.Is(err, errUnauthorized) {
+		a.apiKey.reset()
+	}
+	if err == nil && cfg != nil {
+		a.updateConfig(*cfg)
+	}
+	return err
+}
+
+// 服务端下发的配置有变化时应用并保存到本地
+func (a *agent) updateConfig(cfg AgentConfig) {
+	old, _ := json.Marshal(a.config)
+	b, _ := json.Marshal(cfg)
+	if bytes.Equal(old, b) {
+		return
+	}
+	if err := cfg.validate(); err != nil {
+		log.Println("【Client】", "服务端下发的配置无效:", err)
+		return
+	}
+	if err := writeStateFile(agentConfigFile, b); err != nil {
+		log.Println("【Client】", "保存配置失败:", err)
+	}
+	a.applyConfig(cfg)
+	log.Println("【Client】", "已应用服务端配置:", string(b))
+}
+
+func (a *agent) applyConfig(cfg AgentConfig) {
+	a.config = cfg
+	if cfg.Interval > 0 {
+		a.scheduler.interval = time.Duration(cfg.Interval) * time.Minute
+	} else {
+		a.scheduler.interval = time.Duration(a.opts.Interval) * time.Minute
+	}
+	// 服务端下发的地址优先，其次为启动参数，都未指定时自动发现
+	a.discovered = false
+	var addrs []string
+	switch {
+	case len(cfg.Servers) > 0:
+		addrs = cfg.Servers
+	case len(a.opts.Servers) > 0:
+		addrs = a.opts.Servers
+	case a.opts.ServerIP != "":
+		addrs = []string{a.opts.ServerIP}
+	default:
+		addrs = parseServerList(readStateFile(discoveredServerFile)) // 为空时在上报前查找
+		a.discovered = true
+	}
+	var urls []string
+	for _, addr := range addrs {
+		urls = append(urls, serverURLOf(addr, a.scheme, a.opts.Port))
+	}
+	if a.servers == nil || !a.servers.equal(urls) {
+		a.servers = newServerPool(urls)
+		a.serverURL = a.servers.active()
+	}
+	setLogLevel(cfg.LogLevel)
+	logDebug("【Client】", "服务端地址:", strings.Join(urls, ", "), "上报间隔:", a.scheduler.interval)
+}
 
+// 服务端地址可以是完整 URL，或 host[:port]，未指定端口时使用启动参数中的端口
+func serverURLOf(addr, scheme string, port int) string {
+	addr = strings.TrimSpace(addr)
+	if strings.Contains(addr, "://") {
+		return strings.TrimSuffix(addr, "/")
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), strconv.Itoa(port))
 	}
+	return scheme + "://" + addr
 }
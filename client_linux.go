@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"strings"
+
+	"github.com/shirou/gopsutil/v4/host"
+)
+
+// 操作系统版本，如 ubuntu 22.04
+func getOSVersion(hostInfo *host.InfoStat) string {
+	return strings.TrimSpace(fmt.Sprintf("%v %v", hostInfo.Platform, hostInfo.PlatformVersion))
+}
+
+// 当前用户名
+// 以 root 身份作为守护进程运行时，优先返回已登录的会话用户
+func getUsername() string {
+	currentUser, err := user.Current()
+	if err != nil {
+		fmt.Println("【Client】", "获取客户端信息出错:", err)
+		currentUser = &user.User{Username: "unknown"}
+	}
+	if currentUser.Uid != "0" {
+		return currentUser.Username
+	}
+	users, err := host.Users()
+	if err != nil || len(users) == 0 {
+		return currentUser.Username
+	}
+	return users[0].User
+}
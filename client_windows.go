@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os/user"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/host"
+	"golang.org/x/sys/windows/registry"
+)
+
+// 操作系统版本，如 Microsoft Windows 10 Pro
+func getOSVersion(hostInfo *host.InfoStat) string {
+	return hostInfo.Platform
+}
+
+// 当前用户名
+func getUsername() string {
+	currentUser, err := user.Current()
+	if err != nil {
+		fmt.Println("【Client】", "获取客户端信息出错:", err)
+		return "unknown"
+	}
+	return currentUser.Username
+}
+
+// 注册表中的卸载信息
+type uninstallLocation struct {
+	root   registry.Key
+	path   string
+	source string
+	arch   string
+}
+
+func getPrograms() ProgramList {
+	nativeArch := "x64"
+	if runtime.GOARCH == "386" {
+		nativeArch = "x86"
+	}
+	locations := []uninstallLocation{
+		{registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`, "HKLM", nativeArch},
+		{registry.LOCAL_MACHINE, `SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`, "HKLM", "x86"},
+		{registry.CURRENT_USER, `SOFTWARE\Microsoft\Windows\CurrentVersion\Uninstall`, "HKCU", nativeArch},
+		{registry.CURRENT_USER, `SOFTWARE\WOW6432Node\Microsoft\Windows\CurrentVersion\Uninstall`, "HKCU", "x86"},
+	}
+
+	var programs ProgramList
+	for _, loc := range locations {
+		k, err := registry.OpenKey(loc.root, loc.path, registry.READ)
+		if err != nil {
+			continue
+		}
+		defer k.Close()
+
+		names, err := k.ReadSubKeyNames(-1)
+		if err != nil {
+			continue
+		}
+
+		for _, name := range names {
+			subKey, err := registry.OpenKey(k, name, registry.READ)
+			if err != nil {
+				continue
+			}
+			defer subKey.Close()
+
+			displayName, _, err := subKey.GetStringValue("DisplayName")
+			if err != nil || displayName == "" {
+				continue
+			}
+			version, _, _ := subKey.GetStringValue("DisplayVersion")
+			publisher, _, _ := subKey.GetStringValue("Publisher")
+			installDate, _, _ := subKey.GetStringValue("InstallDate")
+			installLocation, _, _ := subKey.GetStringValue("InstallLocation")
+			programs = append(programs, Program{
+				Name:            displayName,
+				Version:         version,
+				Publisher:       publisher,
+				InstallDate:     formatInstallDate(installDate),
+				InstallLocation: installLocation,
+				Architecture:    loc.arch,
+				Source:          loc.source,
+			})
+		}
+	}
+	return sortPrograms(programs)
+}
+
+// 注册表中 InstallDate 格式为 20060102
+func formatInstallDate(s string) string {
+	t, err := time.Parse("20060102", strings.TrimSpace(s))
+	if err != nil {
+		return s
+	}
+	return t.Format(time.DateOnly)
+}
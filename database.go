@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -20,6 +22,10 @@ func initDataBase() error {
 	if err != nil {
 		return fmt.Errorf("创建表失败: %v", err)
 	}
+	err = migrateDataBase()
+	if err != nil {
+		return fmt.Errorf("升级表结构失败: %v", err)
+	}
 	return err
 }
 
@@ -29,6 +35,20 @@ func openDatabase() error {
 	return err
 }
 
+// 实际读取一次数据库文件，Ping 对 SQLite 总是成功
+func pingDataBase(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	var n int
+	return db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&n)
+}
+
+func closeDataBase() {
+	if db != nil {
+		db.Close()
+	}
+}
+
 func createTable() error {
 	sql := `
 		CREATE TABLE IF NOT EXISTS client_info (
@@ -49,92 +69,540 @@ func createTable() error {
 	return err
 }
 
+// 表结构升级，按顺序执行，已执行的版本号记录在 PRAGMA user_version 中
+// 新的结构变更只能追加到末尾
+var migrations = []func(tx *sql.Tx) error{
+	migrateByteColumns,
+	migrateDiskColumns,
+	migrateNetworkColumns,
+	migrateHostIdentity,
+	migrateSnapshots,
+	migrateHostEvents,
+	migrateAgentCerts,
+	migrateAgentKeys,
+	migrateReportSignature,
+	migrateAgentConfig,
+	migrateAgentTasks,
+	migrateEndpoint,
+	migrateAccessControl,
+	migrateAgentVersion,
+}
+
+func migrateDataBase() error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if err := migrations[i](tx); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("版本 %d: %v", i+1, err)
+		}
+		// PRAGMA 不支持参数绑定
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 内存、磁盘由格式化字符串改为字节数
+func migrateByteColumns(tx *sql.Tx) error {
+	for _, col := range []string{"memory_total", "memory_used", "memory_free", "disk_total", "disk_used", "disk_free"} {
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE client_info ADD COLUMN %s INTEGER NOT NULL DEFAULT 0", col)); err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.Query("SELECT id, memory, disk FROM client_info")
+	if err != nil {
+		return err
+	}
+	type sizeRow struct {
+		id           int
+		memory, disk string
+	}
+	var sizes []sizeRow
+	for rows.Next() {
+		var r sizeRow
+		if err := rows.Scan(&r.id, &r.memory, &r.disk); err != nil {
+			rows.Close()
+			return err
+		}
+		sizes = append(sizes, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, r := range sizes {
+		_, err := tx.Exec("UPDATE client_info SET memory_total = ?, disk_total = ? WHERE id = ?", parseBytes(r.memory), parseBytes(r.disk), r.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("ALTER TABLE client_info DROP COLUMN memory"); err != nil {
+		return err
+	}
+	_, err = tx.Exec("ALTER TABLE client_info DROP COLUMN disk")
+	return err
+}
+
+// 分区和物理磁盘列表
+func migrateDiskColumns(tx *sql.Tx) error {
+	for _, col := range []string{"volumes", "physical_disks"} {
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE client_info ADD COLUMN %s TEXT NOT NULL DEFAULT '[]'", col)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 网卡、网关和 DNS
+func migrateNetworkColumns(tx *sql.Tx) error {
+	for _, col := range []string{"interfaces", "gateways", "dns_servers"} {
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE client_info ADD COLUMN %s TEXT NOT NULL DEFAULT '[]'", col)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 主机身份识别
+func migrateHostIdentity(tx *sql.Tx) error {
+	stmts := []string{
+		`ALTER TABLE client_info ADD COLUMN agent_id TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE client_info ADD COLUMN fingerprint TEXT NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE client_info ADD COLUMN identity_flag TEXT NOT NULL DEFAULT ''`,
+		`CREATE TABLE host_identity (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			agent_id TEXT NOT NULL,
+			hardware_key TEXT NOT NULL,
+			host_id TEXT NOT NULL,
+			reported_host_id TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			flag TEXT NOT NULL DEFAULT '',
+			first_seen TEXT NOT NULL,
+			last_seen TEXT NOT NULL,
+			UNIQUE (agent_id, hardware_key)
+		)`,
+		`CREATE INDEX idx_host_identity_host_id ON host_identity (host_id)`,
+		`CREATE INDEX idx_host_identity_hardware_key ON host_identity (hardware_key)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 历史快照，已有的记录作为各主机的第一份快照
+func migrateSnapshots(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE client_snapshot (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			host_id TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			data TEXT NOT NULL,
+			first_seen TEXT NOT NULL,
+			last_seen TEXT NOT NULL
+		)`,
+		`CREATE INDEX idx_client_snapshot_host_id ON client_snapshot (host_id, first_seen)`,
+		`INSERT INTO client_snapshot (host_id, hash, data, first_seen, last_seen)
+		SELECT host_id, '', json_object(
+			'host_id', host_id, 'agent_id', agent_id, 'fingerprint', json(fingerprint), 'identity_flag', identity_flag,
+			'hostname', hostname, 'username', username, 'os', os, 'cpu', cpu,
+			'memory_total', memory_total, 'memory_used', memory_used, 'memory_free', memory_free,
+			'disk_total', disk_total, 'disk_used', disk_used, 'disk_free', disk_free,
+			'volumes', json(volumes), 'physical_disks', json(physical_disks),
+			'interfaces', json(interfaces), 'gateways', json(gateways), 'dns_servers', json(dns_servers),
+			'ip_addresses', json(ip_addresses), 'mac_addresses', json(mac_addresses), 'programs', json(programs),
+			'updated', updated
+		), updated, updated
+		FROM client_info`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 变更事件
+func migrateHostEvents(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE host_event (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			host_id TEXT NOT NULL,
+			time TEXT NOT NULL,
+			kind TEXT NOT NULL,
+			field TEXT NOT NULL,
+			old_value TEXT NOT NULL,
+			new_value TEXT NOT NULL
+		)`,
+		`CREATE INDEX idx_host_event_host_id ON host_event (host_id, time)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 客户端证书注册记录，每个 HostID 只有一张有效证书
+func migrateAgentCerts(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE TABLE agent_cert (
+			host_id TEXT PRIMARY KEY,
+			agent_id TEXT NOT NULL,
+			serial TEXT NOT NULL,
+			fingerprint TEXT NOT NULL,
+			not_after TEXT NOT NULL,
+			enrolled TEXT NOT NULL
+		)`)
+	return err
+}
+
+// 令牌注册的客户端密钥，只保存哈希；吊销标记同时作用于客户端证书
+func migrateAgentKeys(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE agent_key (
+			agent_id TEXT PRIMARY KEY,
+			host_id TEXT NOT NULL,
+			key_hash TEXT NOT NULL,
+			enrolled TEXT NOT NULL,
+			last_used TEXT NOT NULL DEFAULT '',
+			revoked INTEGER NOT NULL DEFAULT 0
+		)`,
+		`ALTER TABLE agent_cert ADD COLUMN revoked INTEGER NOT NULL DEFAULT 0`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 上报签名：各客户端首次登记的公钥，以及用于防重放的 nonce
+func migrateReportSignature(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE agent_sign_key (
+			agent_id TEXT PRIMARY KEY,
+			public_key TEXT NOT NULL,
+			first_seen TEXT NOT NULL
+		)`,
+		`CREATE TABLE report_nonce (
+			nonce TEXT PRIMARY KEY,
+			agent_id TEXT NOT NULL,
+			time INTEGER NOT NULL
+		)`,
+		`CREATE INDEX idx_report_nonce_time ON report_nonce (time)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 服务端下发的客户端配置和主机分组
+func migrateAgentConfig(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE agent_config (
+			scope TEXT NOT NULL,
+			name TEXT NOT NULL,
+			config TEXT NOT NULL,
+			updated TEXT NOT NULL,
+			PRIMARY KEY (scope, name)
+		)`,
+		`CREATE TABLE host_group (
+			host_id TEXT PRIMARY KEY,
+			group_name TEXT NOT NULL
+		)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 下发给客户端的任务
+func migrateAgentTasks(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE agent_task (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			host_id TEXT NOT NULL,
+			type TEXT NOT NULL,
+			params TEXT NOT NULL DEFAULT '',
+			status TEXT NOT NULL,
+			result TEXT NOT NULL DEFAULT '',
+			created TEXT NOT NULL,
+			started TEXT NOT NULL DEFAULT '',
+			finished TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX idx_agent_task_host_id ON agent_task (host_id, status)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 接收数据的服务端地址
+func migrateEndpoint(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE client_info ADD COLUMN endpoint TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// 查询接口的用户、会话、API 令牌和审计日志
+func migrateAccessControl(tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE app_user (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			username TEXT NOT NULL UNIQUE,
+			password_hash TEXT NOT NULL,
+			role TEXT NOT NULL,
+			created TEXT NOT NULL
+		)`,
+		`CREATE TABLE user_session (
+			token_hash TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			created TEXT NOT NULL,
+			expires INTEGER NOT NULL
+		)`,
+		`CREATE TABLE api_token (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			token_hash TEXT NOT NULL UNIQUE,
+			created TEXT NOT NULL,
+			last_used TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE TABLE audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			time TEXT NOT NULL,
+			username TEXT NOT NULL,
+			action TEXT NOT NULL,
+			host_id TEXT NOT NULL DEFAULT '',
+			detail TEXT NOT NULL DEFAULT '',
+			remote_addr TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX idx_audit_log_host_id ON audit_log (host_id)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 客户端版本，旧版客户端为空
+func migrateAgentVersion(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE client_info ADD COLUMN agent_version TEXT NOT NULL DEFAULT ''`)
+	return err
+}
+
+// client_info 的查询列，与 scanClientInfo 的顺序一致
+const clientInfoColumns = `host_id, agent_id, fingerprint, identity_flag, hostname, username, os, cpu, memory_total, memory_used, memory_free, disk_total, disk_used, disk_free, volumes, physical_disks, interfaces, gateways, dns_servers, ip_addresses, mac_addresses, programs, updated, endpoint, agent_version`
+
 // 新增
-func insertToDB(data ClientInfo) error {
-	stmt, err := db.Prepare(
+func insertToDB(tx *sql.Tx, data ClientInfo) error {
+	stmt, err := tx.Prepare(
 		`INSERT INTO client_info
-			(host_id, hostname, username, os, cpu, memory, disk, ip_addresses, mac_addresses, programs, updated) 
+			(` + clientInfoColumns + `) 
 		VALUES 
-			(?,?,?,?,?,?,?,?,?,?,?)`)
+			(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
+	fpJson, _ := json.Marshal(data.Fingerprint)
+	volJson, _ := json.Marshal(data.Volumes)
+	diskJson, _ := json.Marshal(data.PhysicalDisks)
+	ifaceJson, _ := json.Marshal(data.Interfaces)
+	gwJson, _ := json.Marshal(data.Gateways)
+	dnsJson, _ := json.Marshal(data.DNSServers)
 	ipJson, _ := json.Marshal(data.IPAddresses)
 	macJson, _ := json.Marshal(data.MACAddresses)
 	progJson, _ := json.Marshal(data.Programs)
 
 	_, err = stmt.Exec(
 		data.HostID,
+		data.AgentID,
+		string(fpJson),
+		data.IdentityFlag,
 		data.Hostname,
 		data.Username,
 		data.OS,
 		data.CPU,
-		data.Memory,
-		data.Disk,
+		data.MemoryTotal,
+		data.MemoryUsed,
+		data.MemoryFree,
+		data.DiskTotal,
+		data.DiskUsed,
+		data.DiskFree,
+		string(volJson),
+		string(diskJson),
+		string(ifaceJson),
+		string(gwJson),
+		string(dnsJson),
 		string(ipJson),
 		string(macJson),
 		string(progJson),
 		data.Updated,
+		data.Endpoint,
+		data.AgentVersion,
 	)
 
 	return err
 }
 
 // 更新
-func updateToDB(data ClientInfo) error {
-	stmt, err := db.Prepare(
+func updateToDB(tx *sql.Tx, data ClientInfo) error {
+	stmt, err := tx.Prepare(
 		`UPDATE client_info SET
-		hostname = ?, username = ?, os = ?, cpu = ?, memory = ?, disk = ?, ip_addresses = ?, mac_addresses = ?, programs = ?, updated = ?
+		agent_id = ?, fingerprint = ?, identity_flag = ?, hostname = ?, username = ?, os = ?, cpu = ?, memory_total = ?, memory_used = ?, memory_free = ?, disk_total = ?, disk_used = ?, disk_free = ?, volumes = ?, physical_disks = ?, interfaces = ?, gateways = ?, dns_servers = ?, ip_addresses = ?, mac_addresses = ?, programs = ?, updated = ?, endpoint = ?, agent_version = ?
 		WHERE host_id = ?`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
+	fpJson, _ := json.Marshal(data.Fingerprint)
+	volJson, _ := json.Marshal(data.Volumes)
+	diskJson, _ := json.Marshal(data.PhysicalDisks)
+	ifaceJson, _ := json.Marshal(data.Interfaces)
+	gwJson, _ := json.Marshal(data.Gateways)
+	dnsJson, _ := json.Marshal(data.DNSServers)
 	ipJson, _ := json.Marshal(data.IPAddresses)
 	macJson, _ := json.Marshal(data.MACAddresses)
 	progJson, _ := json.Marshal(data.Programs)
 
 	_, err = stmt.Exec(
+		data.AgentID,
+		string(fpJson),
+		data.IdentityFlag,
 		data.Hostname,
 		data.Username,
 		data.OS,
 		data.CPU,
-		data.Memory,
-		data.Disk,
+		data.MemoryTotal,
+		data.MemoryUsed,
+		data.MemoryFree,
+		data.DiskTotal,
+		data.DiskUsed,
+		data.DiskFree,
+		string(volJson),
+		string(diskJson),
+		string(ifaceJson),
+		string(gwJson),
+		string(dnsJson),
 		string(ipJson),
 		string(macJson),
 		string(progJson),
 		data.Updated,
+		data.Endpoint,
+		data.AgentVersion,
 		data.HostID,
 	)
 
 	return err
 }
 
-func saveToDB(data ClientInfo) error {
-	var exist bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM client_info WHERE host_id = ?)", data.HostID).Scan(&exist)
+// 识别主机身份后更新当前状态，记录与上次相比的变化，并保存一份历史快照
+// data.HostID 改写为识别后的记录
+func saveToDB(data *ClientInfo) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := resolveHostIdentity(tx, data); err != nil {
+		return fmt.Errorf("主机身份识别失败: %v", err)
+	}
+	old, err := scanClientInfo(tx.QueryRow(`SELECT `+clientInfoColumns+` FROM client_info WHERE host_id = ?`, data.HostID))
+	data.keepSkipped(old)
+	replayed := data.Replayed
+	data.Replayed = false
+	switch err {
+	case nil:
+		// 客户端离线缓存的旧数据只补充到历史快照，不覆盖更新的当前状态
+		// 只有补报的数据才比较时间，实时上报总是更新当前状态，不受客户端时钟影响
+		if replayed && reportedBefore(*data, old) {
+			if err := saveBackdatedSnapshot(tx, *data); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}
+		if err := saveHostEvents(tx, old, *data); err != nil {
+			return err
+		}
+		err = updateToDB(tx, *data)
+	case sql.ErrNoRows:
+		err = insertToDB(tx, *data)
+	}
 	if err != nil {
 		return err
 	}
-	if exist {
-		return updateToDB(data)
-	} else {
-		return insertToDB(data)
+	if err := saveSnapshot(tx, *data); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// *sql.DB 和 *sql.Tx 共有的方法，用于既可单独执行也可在事务中执行的操作
+type dbExecutor interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// 按 clientInfoColumns 的顺序解析一行
+func scanClientInfo(row rowScanner) (ClientInfo, error) {
+	var c ClientInfo
+	var fp, vol, pdisk, iface, gw, dns, ip, mac, prog string
+	if err := row.Scan(&c.HostID, &c.AgentID, &fp, &c.IdentityFlag, &c.Hostname, &c.Username, &c.OS, &c.CPU, &c.MemoryTotal, &c.MemoryUsed, &c.MemoryFree, &c.DiskTotal, &c.DiskUsed, &c.DiskFree, &vol, &pdisk, &iface, &gw, &dns, &ip, &mac, &prog, &c.Updated, &c.Endpoint, &c.AgentVersion); err != nil {
+		return c, err
 	}
+	// 忽略 json 解析失败错误
+	json.Unmarshal([]byte(fp), &c.Fingerprint)
+	json.Unmarshal([]byte(vol), &c.Volumes)
+	json.Unmarshal([]byte(pdisk), &c.PhysicalDisks)
+	json.Unmarshal([]byte(iface), &c.Interfaces)
+	json.Unmarshal([]byte(gw), &c.Gateways)
+	json.Unmarshal([]byte(dns), &c.DNSServers)
+	json.Unmarshal([]byte(ip), &c.IPAddresses)
+	json.Unmarshal([]byte(mac), &c.MACAddresses)
+	json.Unmarshal([]byte(prog), &c.Programs)
+	return c, nil
 }
 
-// 分页查询
+// 分页查询，client_info 中每台主机只保留最新状态
 func queryClientInfoByPage(limit, offset int) ([]ClientInfo, error) {
-	query := `SELECT host_id, hostname, username, os, cpu, memory, disk, ip_addresses, mac_addresses, programs, updated
+	query := `SELECT ` + clientInfoColumns + `
 			FROM client_info
-			WHERE (updated) IN (
-				SELECT MAX(updated)
-				FROM client_info
-				GROUP BY host_id
-			)
-			ORDER BY updated DESC
+			ORDER BY julianday(updated) DESC
 			LIMIT ? OFFSET ?`
 	rows, err := db.Query(query, limit, offset)
 	if err != nil {
@@ -146,16 +614,10 @@ func queryClientInfoByPage(limit, offset int) ([]ClientInfo, error) {
 	var clients []ClientInfo
 
 	for rows.Next() {
-		var c ClientInfo
-		var ip, mac, prog string
-		if err := rows.Scan(&c.HostID, &c.Hostname, &c.Username, &c.OS, &c.CPU, &c.Memory, &c.Disk, &ip, &mac, &prog, &c.Updated); err != nil {
+		c, err := scanClientInfo(rows)
+		if err != nil {
 			return nil, fmt.Errorf("分页查询解析错误: %v", err)
 		}
-		// 忽略 json 解析失败错误
-		json.Unmarshal([]byte(ip), &c.IPAddresses)
-		json.Unmarshal([]byte(mac), &c.MACAddresses)
-		json.Unmarshal([]byte(prog), &c.Programs)
-
 		clients = append(clients, c)
 	}
 	if err := rows.Err(); err != nil {
@@ -164,6 +626,12 @@ func queryClientInfoByPage(limit, offset int) ([]ClientInfo, error) {
 	return clients, nil
 }
 
+// 按 HostID 查询当前状态
+func queryClientInfo(hostID string) (ClientInfo, error) {
+	row := db.QueryRow(`SELECT `+clientInfoColumns+` FROM client_info WHERE host_id = ?`, hostID)
+	return scanClientInfo(row)
+}
+
 // 查询记录总数
 func queryClientInfoTotal() (int, error) {
 	var total int = 0
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// 变更类型
+const (
+	changeField          = "field"
+	changeProgramAdded   = "program_added"
+	changeProgramRemoved = "program_removed"
+	changeProgramUpdated = "program_updated"
+	changeIPAdded        = "ip_added"
+	changeIPRemoved      = "ip_removed"
+	changeMACAdded       = "mac_added"
+	changeMACRemoved     = "mac_removed"
+)
+
+// 两次上报之间的一项变化
+type HostChange struct {
+	Kind  string `json:"kind"`
+	Field string `json:"field"` // 字段名、软件名或地址
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+func (c HostChange) String() string {
+	switch c.Kind {
+	case changeField, changeProgramUpdated:
+		return fmt.Sprintf("%s %s: %s -> %s", c.Kind, c.Field, c.Old, c.New)
+	case changeProgramAdded, changeIPAdded, changeMACAdded:
+		return strings.TrimSpace(fmt.Sprintf("%s %s %s", c.Kind, c.Field, c.New))
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %s %s", c.Kind, c.Field, c.Old))
+}
+
+// 比较两份上报数据，内存、磁盘的实时用量和上报时间不算作变化
+func diffClientInfo(old, new ClientInfo) []HostChange {
+	var changes []HostChange
+
+	fields := []struct {
+		name     string
+		old, new string
+	}{
+		{"Hostname", old.Hostname, new.Hostname},
+		{"Username", old.Username, new.Username},
+		{"OS", old.OS, new.OS},
+		{"CPU", old.CPU, new.CPU},
+		{"AgentID", old.AgentID, new.AgentID},
+	}
+	for _, f := range fields {
+		if f.old != f.new {
+			changes = append(changes, HostChange{Kind: changeField, Field: f.name, Old: f.old, New: f.new})
+		}
+	}
+	sizes := []struct {
+		name     string
+		old, new ByteSize
+	}{
+		{"MemoryTotal", old.MemoryTotal, new.MemoryTotal},
+		{"DiskTotal", old.DiskTotal, new.DiskTotal},
+	}
+	for _, f := range sizes {
+		if f.old != f.new {
+			changes = append(changes, HostChange{Kind: changeField, Field: f.name, Old: f.old.String(), New: f.new.String()})
+		}
+	}
+
+	changes = append(changes, diffPrograms(old.Programs, new.Programs)...)
+	changes = append(changes, diffStrings(old.IPAddresses, new.IPAddresses, changeIPAdded, changeIPRemoved)...)
+	changes = append(changes, diffStrings(old.MACAddresses, new.MACAddresses, changeMACAdded, changeMACRemoved)...)
+	return changes
+}
+
+// 以名称、来源和架构区分同一软件，版本不同视为升级
+func diffPrograms(old, new ProgramList) []HostChange {
+	key := func(p Program) string {
+		return p.Name + "|" + p.Source + "|" + p.Architecture
+	}
+	oldMap := make(map[string]Program, len(old))
+	for _, p := range old {
+		if p.Name != "unknown" {
+			oldMap[key(p)] = p
+		}
+	}
+	newMap := make(map[string]Program, len(new))
+	for _, p := range new {
+		if p.Name != "unknown" {
+			newMap[key(p)] = p
+		}
+	}
+
+	var changes []HostChange
+	for _, p := range new {
+		o, ok := oldMap[key(p)]
+		switch {
+		case p.Name == "unknown":
+		case !ok:
+			changes = append(changes, HostChange{Kind: changeProgramAdded, Field: p.Name, New: p.Version})
+		case o.Version != p.Version:
+			changes = append(changes, HostChange{Kind: changeProgramUpdated, Field: p.Name, Old: o.Version, New: p.Version})
+		}
+	}
+	for _, p := range old {
+		if _, ok := newMap[key(p)]; !ok && p.Name != "unknown" {
+			changes = append(changes, HostChange{Kind: changeProgramRemoved, Field: p.Name, Old: p.Version})
+		}
+	}
+	return changes
+}
+
+// 比较地址列表，忽略 unknown 占位
+func diffStrings(old, new []string, added, removed string) []HostChange {
+	var changes []HostChange
+	for _, v := range new {
+		if v != "unknown" && !slices.Contains(old, v) {
+			changes = append(changes, HostChange{Kind: added, Field: v})
+		}
+	}
+	for _, v := range old {
+		if v != "unknown" && !slices.Contains(new, v) {
+			changes = append(changes, HostChange{Kind: removed, Field: v})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	discoveryService = "cinfocollect" // SRV 记录 _cinfocollect._tcp.<域>
+	discoveryRequest = "CINFOCOLLECT_DISCOVER"
+	discoveryTimeout = 2 * time.Second
+
+	discoveredServerFile = "discovered_server" // 缓存发现的服务端地址，每行一个
+)
+
+// 服务端对广播的应答
+type discoveryReply struct {
+	Port int  `json:"port"`
+	TLS  bool `json:"tls"`
+}
+
+// 服务端在与服务相同的 UDP 端口上应答客户端的发现广播，返回的连接在退出时关闭
+func startDiscoveryResponder(opts ServerOptions) net.PacketConn {
+	conn, err := net.ListenPacket("udp4", fmt.Sprintf(":%d", opts.Port))
+	if err != nil {
+		log.Println("【Server】", "服务发现监听失败:", err)
+		return nil
+	}
+	reply, _ := json.Marshal(discoveryReply{Port: opts.Port, TLS: opts.TLS})
+	log.Println("【Server】", "服务发现监听 UDP 端口:", opts.Port)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			if string(buf[:n]) != discoveryRequest {
+				continue
+			}
+			conn.WriteTo(reply, addr)
+		}
+	}()
+	return conn
+}
+
+// 查找服务端：先查询本机 DNS 域的 SRV 记录，再在局域网内广播，返回服务端 URL 列表
+func discoverServer(scheme string, port int) ([]string, error) {
+	if addrs := lookupServerSRV(); len(addrs) > 0 {
+		var urls []string
+		for _, addr := range addrs {
+			urls = append(urls, scheme+"://"+addr)
+		}
+		log.Println("【Client】", "通过 DNS SRV 发现服务端:", strings.Join(urls, ", "))
+		return urls, nil
+	}
+	url, err := broadcastDiscover(scheme, port)
+	if err != nil {
+		return nil, err
+	}
+	log.Println("【Client】", "通过局域网广播发现服务端:", url)
+	return []string{url}, nil
+}
+
+// 本机所在的 DNS 域，未配置时取完整主机名中的域名部分
+func discoveryDomains() []string {
+	domains := getDNSDomains()
+	if hostname, err := os.Hostname(); err == nil {
+		if _, domain, ok := strings.Cut(hostname, "."); ok {
+			domains = appendUnique(domains, domain)
+		}
+	}
+	return domains
+}
+
+// 按记录的优先级和权重排序，用于故障切换
+func lookupServerSRV() []string {
+	for _, domain := range discoveryDomains() {
+		_, records, err := net.LookupSRV(discoveryService, "tcp", domain)
+		if err != nil || len(records) == 0 {
+			continue
+		}
+		var addrs []string
+		for _, r := range records {
+			addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+		}
+		return addrs
+	}
+	return nil
+}
+
+// 向受限广播地址和各网卡的子网广播地址发送请求，使用第一个应答的服务端
+func broadcastDiscover(scheme string, port int) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	targets := []net.IP{net.IPv4bcast}
+	targets = append(targets, broadcastAddresses()...)
+	for _, ip := range targets {
+		conn.WriteTo([]byte(discoveryRequest), &net.UDPAddr{IP: ip, Port: port})
+	}
+
+	conn.SetReadDeadline(time.Now().Add(discoveryTimeout))
+	buf := make([]byte, 256)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return "", fmt.Errorf("未发现服务端: %v", err)
+		}
+		var reply discoveryReply
+		if json.Unmarshal(buf[:n], &reply) != nil || reply.Port == 0 {
+			continue
+		}
+		if reply.TLS {
+			scheme = "https"
+		}
+		host := addr.(*net.UDPAddr).IP.String()
+		return scheme + "://" + net.JoinHostPort(host, strconv.Itoa(reply.Port)), nil
+	}
+}
+
+// 已连接网卡的 IPv4 子网广播地址
+func broadcastAddresses() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var ips []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip := ipnet.IP.To4()
+			if ip == nil || len(ipnet.Mask) != net.IPv4len {
+				continue
+			}
+			bcast := make(net.IP, net.IPv4len)
+			for i := range ip {
+				bcast[i] = ip[i] | ^ipnet.Mask[i]
+			}
+			ips = append(ips, bcast)
+		}
+	}
+	return ips
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const sysBlockDir = "/sys/block"
+
+// 物理磁盘，读取 /sys/block，忽略 loop、zram、dm 等虚拟块设备
+func getPhysicalDisks() []PhysicalDisk {
+	var disks []PhysicalDisk
+	entries, err := os.ReadDir(sysBlockDir)
+	if err != nil {
+		return disks
+	}
+	for _, e := range entries {
+		dir := filepath.Join(sysBlockDir, e.Name())
+		devPath, err := filepath.EvalSymlinks(dir)
+		if err != nil || strings.Contains(devPath, "/virtual/") {
+			continue
+		}
+		if strings.HasPrefix(e.Name(), "sr") {
+			continue // 光驱
+		}
+		d := PhysicalDisk{
+			Name:   e.Name(),
+			Model:  readSysFile(filepath.Join(dir, "device", "model")),
+			Serial: getBlockSerial(dir),
+			Bus:    getBlockBus(devPath),
+		}
+		// size 以 512 字节扇区为单位，与实际扇区大小无关
+		if sectors, err := strconv.ParseUint(readSysFile(filepath.Join(dir, "size")), 10, 64); err == nil {
+			d.Size = ByteSize(sectors * 512)
+		}
+		switch readSysFile(filepath.Join(dir, "queue", "rotational")) {
+		case "1":
+			d.MediaType = "HDD"
+		case "0":
+			d.MediaType = "SSD"
+		}
+		disks = append(disks, d)
+	}
+	return disks
+}
+
+func readSysFile(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// 序列号，NVMe 在 device/serial，virtio 在 serial，SCSI/SATA 在 VPD 80 页
+func getBlockSerial(dir string) string {
+	for _, name := range []string{"device/serial", "serial"} {
+		if serial := readSysFile(filepath.Join(dir, name)); serial != "" {
+			return serial
+		}
+	}
+	// VPD 80 页前 4 字节为页头
+	b, err := os.ReadFile(filepath.Join(dir, "device", "vpd_pg80"))
+	if err != nil || len(b) <= 4 {
+		return ""
+	}
+	return strings.TrimSpace(strings.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return -1
+		}
+		return r
+	}, string(b[4:])))
+}
+
+// 根据设备在 sysfs 中的路径判断总线类型
+func getBlockBus(devPath string) string {
+	switch {
+	case strings.Contains(devPath, "/usb"):
+		return "usb"
+	case strings.Contains(devPath, "/nvme"):
+		return "nvme"
+	case strings.Contains(devPath, "/virtio"):
+		return "virtio"
+	case strings.Contains(devPath, "/mmc"):
+		return "mmc"
+	case strings.Contains(devPath, "/ata"):
+		return "sata"
+	case strings.Contains(devPath, "/host"):
+		return "scsi"
+	}
+	return ""
+}
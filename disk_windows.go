@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/yusufpapurcu/wmi"
+)
+
+// Windows 8 / Server 2012 起提供的存储管理 WMI 类
+type msftPhysicalDisk struct {
+	DeviceId     string
+	FriendlyName string
+	SerialNumber string
+	Size         uint64
+	MediaType    uint16
+	BusType      uint16
+}
+
+// 旧版系统使用的 WMI 类，无法判断介质类型
+type win32DiskDrive struct {
+	DeviceID      string
+	Model         string
+	SerialNumber  string
+	Size          uint64
+	InterfaceType string
+}
+
+// MSFT_PhysicalDisk 中 BusType 取值
+var msftBusTypes = map[uint16]string{
+	1:  "scsi",
+	3:  "ata",
+	6:  "fibre",
+	7:  "usb",
+	8:  "raid",
+	10: "sas",
+	11: "sata",
+	12: "sd",
+	13: "mmc",
+	15: "file",
+	17: "nvme",
+}
+
+func getPhysicalDisks() []PhysicalDisk {
+	var disks []PhysicalDisk
+	var msft []msftPhysicalDisk
+	err := wmi.QueryNamespace("SELECT DeviceId, FriendlyName, SerialNumber, Size, MediaType, BusType FROM MSFT_PhysicalDisk", &msft, `root\Microsoft\Windows\Storage`)
+	if err == nil {
+		for _, d := range msft {
+			pd := PhysicalDisk{
+				Name:   `\\.\PHYSICALDRIVE` + d.DeviceId,
+				Model:  strings.TrimSpace(d.FriendlyName),
+				Serial: strings.TrimSpace(d.SerialNumber),
+				Size:   ByteSize(d.Size),
+				Bus:    msftBusTypes[d.BusType],
+			}
+			switch d.MediaType {
+			case 3:
+				pd.MediaType = "HDD"
+			case 4:
+				pd.MediaType = "SSD"
+			}
+			disks = append(disks, pd)
+		}
+		return disks
+	}
+
+	var drives []win32DiskDrive
+	if err := wmi.Query("SELECT DeviceID, Model, SerialNumber, Size, InterfaceType FROM Win32_DiskDrive", &drives); err != nil {
+		fmt.Println("【Client】", "获取客户端信息出错:", err)
+		return disks
+	}
+	for _, d := range drives {
+		disks = append(disks, PhysicalDisk{
+			Name:   d.DeviceID,
+			Model:  strings.TrimSpace(d.Model),
+			Serial: strings.TrimSpace(d.SerialNumber),
+			Size:   ByteSize(d.Size),
+			Bus:    strings.ToLower(d.InterfaceType),
+		})
+	}
+	return disks
+}
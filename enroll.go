@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 启用令牌注册时的预共享注册令牌，为空表示不校验客户端密钥
+var enrollToken string
+
+// 客户端注册请求
+// 提供 CSR 时签发客户端证书（CN 必须与 HostID 一致），否则凭注册令牌获取客户端密钥
+// 服务端设置了注册令牌时两种方式都需要提供令牌
+type EnrollRequest struct {
+	HostID  string `json:"host_id"`
+	AgentID string `json:"agent_id"`
+	CSR     string `json:"csr,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+type EnrollResponse struct {
+	Certificate   string `json:"certificate,omitempty"`
+	CACertificate string `json:"ca_certificate,omitempty"`
+	APIKey        string `json:"api_key,omitempty"`
+}
+
+// 处理客户端注册
+func handleEnroll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持 POST 请求", http.StatusMethodNotAllowed)
+		return
+	}
+	var req EnrollRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.HostID == "" {
+		http.Error(w, "无效请求", http.StatusBadRequest)
+		return
+	}
+	if req.CSR != "" {
+		enrollCert(w, r, req)
+	} else {
+		enrollKey(w, r, req)
+	}
+}
+
+// 签发客户端证书
+// 同一 HostID 只能注册一次，之后只能由持有当前有效证书的客户端续期
+func enrollCert(w http.ResponseWriter, r *http.Request, req EnrollRequest) {
+	if agentCA == nil {
+		http.Error(w, "未启用客户端证书", http.StatusNotFound)
+		return
+	}
+	if enrollToken != "" && !checkEnrollToken(w, r, req) {
+		return
+	}
+	block, _ := pem.Decode([]byte(req.CSR))
+	if block == nil {
+		http.Error(w, "无效 CSR", http.StatusBadRequest)
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err == nil {
+		err = csr.CheckSignature()
+	}
+	if err != nil {
+		http.Error(w, "无效 CSR", http.StatusBadRequest)
+		return
+	}
+	if csr.Subject.CommonName != req.HostID {
+		http.Error(w, "CSR 与 HostID 不一致", http.StatusBadRequest)
+		return
+	}
+
+	var revoked bool
+	err = db.QueryRow("SELECT revoked FROM agent_cert WHERE host_id = ?", req.HostID).Scan(&revoked)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("【Server】", "查询注册记录失败:", err)
+		http.Error(w, "服务端错误", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		if revoked {
+			log.Printf("【Server】 拒绝已吊销的 %v 注册\n", req.HostID)
+			http.Error(w, "客户端已吊销", http.StatusForbidden)
+			return
+		}
+		if err := checkClientCert(r, req.HostID); err != nil {
+			log.Printf("【Server】 拒绝 %v 重复注册: %v\n", req.HostID, err)
+			http.Error(w, "HostID 已注册", http.StatusConflict)
+			return
+		}
+	}
+
+	cert, err := agentCA.signCSR(csr)
+	if err != nil {
+		log.Println("【Server】", "签发证书失败:", err)
+		http.Error(w, "服务端错误", http.StatusInternalServerError)
+		return
+	}
+	_, err = db.Exec(`INSERT INTO agent_cert (host_id, agent_id, serial, fingerprint, not_after, enrolled) VALUES (?,?,?,?,?,?)
+		ON CONFLICT (host_id) DO UPDATE SET agent_id = excluded.agent_id, serial = excluded.serial,
+			fingerprint = excluded.fingerprint, not_after = excluded.not_after, enrolled = excluded.enrolled`,
+		req.HostID, req.AgentID, cert.SerialNumber.Text(16), certFingerprint(cert),
+		cert.NotAfter.Format(time.RFC3339), time.Now().Format(time.RFC3339))
+	if err != nil {
+		log.Println("【Server】", "保存注册记录失败:", err)
+		http.Error(w, "服务端错误", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("【Server】 为 %v 签发客户端证书，有效期至 %v\n", req.HostID, cert.NotAfter.Format(time.DateOnly))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EnrollResponse{
+		Certificate:   string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})),
+		CACertificate: string(agentCA.certPEM),
+	})
+}
+
+// 校验客户端证书：证书链有效、CN 与 HostID 一致，且为该 HostID 当前注册且未吊销的证书
+// 续期后旧证书即失效
+func checkClientCert(r *http.Request, hostID string) error {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return fmt.Errorf("未提供有效的客户端证书")
+	}
+	leaf := r.TLS.VerifiedChains[0][0]
+	if leaf.Subject.CommonName != hostID {
+		return fmt.Errorf("证书 %v 不能用于 %v", leaf.Subject.CommonName, hostID)
+	}
+	var fingerprint string
+	var revoked bool
+	err := db.QueryRow("SELECT fingerprint, revoked FROM agent_cert WHERE host_id = ?", hostID).Scan(&fingerprint, &revoked)
+	switch {
+	case err == sql.ErrNoRows || (err == nil && fingerprint != certFingerprint(leaf)):
+		return fmt.Errorf("证书已失效")
+	case err == nil && revoked:
+		return fmt.Errorf("客户端已吊销")
+	}
+	return err
+}
+
+// 凭注册令牌发放客户端密钥
+// 同一 agent 已注册时只能由持有当前密钥的客户端更换密钥
+func enrollKey(w http.ResponseWriter, r *http.Request, req EnrollRequest) {
+	if enrollToken == "" {
+		http.Error(w, "未启用令牌注册", http.StatusNotFound)
+		return
+	}
+	if !checkEnrollToken(w, r, req) {
+		return
+	}
+	if req.AgentID == "" {
+		http.Error(w, "缺少 agent ID", http.StatusBadRequest)
+		return
+	}
+
+	var revoked bool
+	err := db.QueryRow("SELECT revoked FROM agent_key WHERE agent_id = ?", req.AgentID).Scan(&revoked)
+	if err != nil && err != sql.ErrNoRows {
+		log.Println("【Server】", "查询注册记录失败:", err)
+		http.Error(w, "服务端错误", http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		if revoked {
+			log.Printf("【Server】 拒绝已吊销的 agent %v 注册\n", req.AgentID)
+			http.Error(w, "客户端已吊销", http.StatusForbidden)
+			return
+		}
+		if err := checkAgentKey(r, req.AgentID, req.HostID); err != nil {
+			log.Printf("【Server】 拒绝 agent %v 重复注册: %v\n", req.AgentID, err)
+			http.Error(w, "agent 已注册", http.StatusConflict)
+			return
+		}
+	}
+
+	key, err := newAgentKey()
+	if err != nil {
+		log.Println("【Server】", "生成密钥失败:", err)
+		http.Error(w, "服务端错误", http.StatusInternalServerError)
+		return
+	}
+	_, err = db.Exec(`INSERT INTO agent_key (agent_id, host_id, key_hash, enrolled) VALUES (?,?,?,?)
+		ON CONFLICT (agent_id) DO UPDATE SET host_id = excluded.host_id, key_hash = excluded.key_hash, enrolled = excluded.enrolled`,
+		req.AgentID, req.HostID, hashAgentKey(key), time.Now().Format(time.RFC3339))
+	if err != nil {
+		log.Println("【Server】", "保存注册记录失败:", err)
+		http.Error(w, "服务端错误", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("【Server】 agent %v（%v）注册成功\n", req.AgentID, req.HostID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(EnrollResponse{APIKey: key})
+}
+
+// 校验注册令牌，失败时写入响应并返回 false
+func checkEnrollToken(w http.ResponseWriter, r *http.Request, req EnrollRequest) bool {
+	if subtle.ConstantTimeCompare([]byte(req.Token), []byte(enrollToken)) != 1 {
+		log.Printf("【Server】 拒绝来自 %v 的注册: 注册令牌错误\n", r.RemoteAddr)
+		http.Error(w, "注册令牌错误", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func newAgentKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 密钥为 256 位随机数，直接使用 SHA-256 保存
+func hashAgentKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// 密钥有效但 HostID 与注册时不一致，重新注册也无法解决
+var errAgentHostMismatch = errors.New("HostID 与注册时不一致")
+
+// 校验请求头 Authorization: Bearer <密钥>，密钥只能用于注册时的 HostID
+// 否则持有注册令牌的人可以注册新 agent 后冒充其他主机上报
+func checkAgentKey(r *http.Request, agentID, hostID string) error {
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || key == "" {
+		return fmt.Errorf("未提供客户端密钥")
+	}
+	var hash, enrolledHostID string
+	var revoked bool
+	err := db.QueryRow("SELECT key_hash, host_id, revoked FROM agent_key WHERE agent_id = ?", agentID).Scan(&hash, &enrolledHostID, &revoked)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("agent %v 未注册", agentID)
+	}
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAgentKey(key)), []byte(hash)) != 1 {
+		return fmt.Errorf("客户端密钥错误")
+	}
+	if revoked {
+		return fmt.Errorf("客户端已吊销")
+	}
+	if hostID != enrolledHostID {
+		return fmt.Errorf("%w: %v，注册时为 %v", errAgentHostMismatch, hostID, enrolledHostID)
+	}
+	_, err = db.Exec("UPDATE agent_key SET last_used = ? WHERE agent_id = ?", time.Now().Format(time.RFC3339), agentID)
+	return err
+}
+
+// 上报认证，启用了哪种方式就校验哪种，都未启用时不校验
+// 只有客户端密钥无效时返回 401，客户端据此重新注册；HostID 不一致时返回 403
+func authenticateReport(r *http.Request, data *ClientInfo) (int, error) {
+	if agentCA != nil {
+		if err := checkClientCert(r, data.HostID); err != nil {
+			return http.StatusForbidden, err
+		}
+	}
+	if enrollToken != "" {
+		if err := checkAgentKey(r, data.AgentID, data.HostID); err != nil {
+			if errors.Is(err, errAgentHostMismatch) {
+				return http.StatusForbidden, err
+			}
+			return http.StatusUnauthorized, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// 吊销客户端：密钥和证书均失效，且不能再次注册
+func revokeAgent(agentID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var n int64
+	for _, query := range []string{
+		"UPDATE agent_key SET revoked = 1 WHERE agent_id = ?",
+		"UPDATE agent_cert SET revoked = 1 WHERE agent_id = ?",
+	} {
+		res, err := tx.Exec(query, agentID)
+		if err != nil {
+			return err
+		}
+		affected, _ := res.RowsAffected()
+		n += affected
+	}
+	if n == 0 {
+		return fmt.Errorf("agent %v 未注册", agentID)
+	}
+	return tx.Commit()
+}
+
+func runRevokeCommand(agentID string) {
+	if err := initDataBase(); err != nil {
+		log.Fatalln("【Server】", err)
+	}
+	defer closeDataBase()
+
+	if err := revokeAgent(agentID); err != nil {
+		log.Fatalln("【Server】", "吊销客户端失败:", err)
+	}
+	log.Printf("【Server】 已吊销 agent %v\n", agentID)
+}
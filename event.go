@@ -0,0 +1,72 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// 主机变更事件
+type HostEvent struct {
+	ID     int64  `json:"id"`
+	HostID string `json:"host_id"`
+	Time   string `json:"time"` // 检测到变化的那次上报时间
+	HostChange
+}
+
+func (e HostEvent) String() string {
+	return fmt.Sprintf("%s %v", e.Time, e.HostChange)
+}
+
+// 与当前状态比较，将变化保存为事件
+func saveHostEvents(tx *sql.Tx, old, data ClientInfo) error {
+	changes := diffClientInfo(old, data)
+	if len(changes) == 0 {
+		return nil
+	}
+	stmt, err := tx.Prepare("INSERT INTO host_event (host_id, time, kind, field, old_value, new_value) VALUES (?,?,?,?,?,?)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, c := range changes {
+		if _, err := stmt.Exec(data.HostID, data.Updated, c.Kind, c.Field, c.Old, c.New); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 分页查询主机的变更事件，按时间倒序
+func queryHostEvents(hostID string, limit, offset int) ([]HostEvent, error) {
+	rows, err := db.Query(`SELECT id, host_id, time, kind, field, old_value, new_value
+			FROM host_event
+			WHERE host_id = ?
+			ORDER BY julianday(time) DESC, id DESC
+			LIMIT ? OFFSET ?`, hostID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("变更事件查询失败: %v", err)
+	}
+	defer rows.Close()
+
+	var events []HostEvent
+	for rows.Next() {
+		var e HostEvent
+		if err := rows.Scan(&e.ID, &e.HostID, &e.Time, &e.Kind, &e.Field, &e.Old, &e.New); err != nil {
+			return nil, fmt.Errorf("变更事件查询解析错误: %v", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("变更事件查询遍历错误: %v", err)
+	}
+	return events, nil
+}
+
+// 主机的变更事件总数
+func queryHostEventsTotal(hostID string) (int, error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM host_event WHERE host_id = ?", hostID).Scan(&total); err != nil {
+		return 0, fmt.Errorf("查询变更事件总数失败: %v", err)
+	}
+	return total, nil
+}
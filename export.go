@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 主机表格的列，界面和网页导出时一致
+var hostTableColumns = []string{"ID", "HostID", "Hostname", "Username", "OS", "CPU", "Memory", "Disk", "Online", "Flag"}
+
+// 转换为 xlsx 单元格格式，如将 0 转 A, ... , 26 转 AA
+func columnLetter(col int) string {
+	result := ""
+	for col >= 0 {
+		result = string(rune('A'+(col%26))) + result
+		col = col/26 - 1
+	}
+	return result
+}
+
+// 导出主机列表，列与界面表格一致，网卡信息导出到单独的工作表，每张网卡一行
+func exportHostsWorkbook(clients []ClientInfo) *excelize.File {
+	f := excelize.NewFile()
+	sheet := "Sheet1"
+	for col, title := range hostTableColumns {
+		f.SetCellValue(sheet, fmt.Sprintf("%s1", columnLetter(col)), title)
+	}
+	for i, c := range clients {
+		online := "Off"
+		if isOnline(c.Updated) {
+			online = "On"
+		}
+		values := []any{i + 1, c.HostID, c.Hostname, c.Username, c.OS, c.CPU, c.MemoryTotal.String(), c.DiskTotal.String(), online, c.IdentityFlag}
+		for col, value := range values {
+			f.SetCellValue(sheet, fmt.Sprintf("%s%d", columnLetter(col), i+2), value)
+		}
+	}
+	writeInterfaceSheet(f, clients)
+	return f
+}
+
+// 网卡信息导出到单独的工作表，每张网卡一行，界面导出时同样使用
+func writeInterfaceSheet(f *excelize.File, clients []ClientInfo) {
+	sheet := "NICs"
+	f.NewSheet(sheet)
+	titles := []string{"HostID", "Hostname", "Name", "MAC", "Up", "MTU", "IPv4", "IPv6"}
+	for col, title := range titles {
+		f.SetCellValue(sheet, fmt.Sprintf("%s1", columnLetter(col)), title)
+	}
+	outputRow := 2
+	for _, c := range clients {
+		for _, n := range c.Interfaces {
+			values := []any{c.HostID, c.Hostname, n.Name, n.MAC, n.Up, n.MTU, strings.Join(n.IPv4, "\n"), strings.Join(n.IPv6, "\n")}
+			for col, value := range values {
+				f.SetCellValue(sheet, fmt.Sprintf("%s%d", columnLetter(col), outputRow), value)
+			}
+			outputRow++
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const agentIDFile = "agent_id"
+
+// 主机指纹，服务端据此识别克隆和重装的机器
+type HostFingerprint struct {
+	MachineID    string   `json:"machine_id"`    // /etc/machine-id 或注册表 MachineGuid
+	SMBIOSSerial string   `json:"smbios_serial"` // 整机序列号
+	SMBIOSUUID   string   `json:"smbios_uuid"`
+	MACs         []string `json:"macs"` // 物理网卡 MAC，已排序
+}
+
+func (f HostFingerprint) String() string {
+	return fmt.Sprintf("machine-id=%s serial=%s uuid=%s macs=%s", f.MachineID, f.SMBIOSSerial, f.SMBIOSUUID, strings.Join(f.MACs, ","))
+}
+
+// 硬件标识，优先使用 SMBIOS UUID，其次序列号，都没有时使用物理网卡 MAC
+// Linux 下 SMBIOS 信息只有 root 可读，普通用户运行的客户端使用 MAC
+// 克隆的虚拟机通常会生成新的 SMBIOS UUID 和 MAC，而 machine-id 会被一并复制，因此不参与比较
+func (f HostFingerprint) hardwareKey() string {
+	if f.SMBIOSUUID != "" {
+		return "uuid:" + f.SMBIOSUUID
+	}
+	if f.SMBIOSSerial != "" {
+		return "serial:" + f.SMBIOSSerial
+	}
+	if len(f.MACs) > 0 {
+		return "mac:" + strings.Join(f.MACs, ",")
+	}
+	return ""
+}
+
+// 两份指纹是否确实来自不同的硬件：SMBIOS UUID 或序列号都有值且不同，或物理网卡 MAC 没有交集
+// 一方缺少某项信息时不能据此判断，如普通用户运行时读不到 SMBIOS、更换或新增网卡
+func (f HostFingerprint) conflictsWith(o HostFingerprint) bool {
+	if f.SMBIOSUUID != "" && o.SMBIOSUUID != "" {
+		return f.SMBIOSUUID != o.SMBIOSUUID
+	}
+	if f.SMBIOSSerial != "" && o.SMBIOSSerial != "" {
+		return f.SMBIOSSerial != o.SMBIOSSerial
+	}
+	if len(f.MACs) > 0 && len(o.MACs) > 0 {
+		return !slices.ContainsFunc(f.MACs, func(mac string) bool { return slices.Contains(o.MACs, mac) })
+	}
+	return false
+}
+
+// 客户端持久化的唯一标识，首次运行时生成
+func getAgentID() string {
+	if id := readStateFile(agentIDFile); id != "" {
+		return id
+	}
+	id := newUUID()
+	if err := writeStateFile(agentIDFile, []byte(id)); err != nil {
+		log.Println("【Client】", "保存 agent ID 失败:", err)
+	}
+	return id
+}
+
+// 随机生成 UUID v4
+func newUUID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func getFingerprint(ifaces []NetInterface) HostFingerprint {
+	serial, uuid := getSMBIOSInfo()
+	return HostFingerprint{
+		MachineID:    getMachineID(),
+		SMBIOSSerial: cleanSMBIOSValue(serial),
+		SMBIOSUUID:   cleanSMBIOSValue(strings.ToLower(uuid)),
+		MACs:         primaryMACs(ifaces),
+	}
+}
+
+// 主板或 PCI 上的物理网卡 MAC，未连接的网卡也计入，插拔网线不影响结果
+// 忽略 USB 网卡（扩展坞）、VPN 和虚拟网卡，以及本地管理地址（docker、虚拟网桥等）
+func primaryMACs(ifaces []NetInterface) []string {
+	persistent := persistentNICs()
+	var macs []string
+	for _, iface := range ifaces {
+		if !persistent[iface.Name] {
+			continue
+		}
+		hw, err := net.ParseMAC(iface.MAC)
+		if err != nil || len(hw) == 0 || hw[0]&0x02 != 0 {
+			continue
+		}
+		macs = appendUnique(macs, hw.String())
+	}
+	sort.Strings(macs)
+	return macs
+}
+
+// 部分主板厂商未填写 SMBIOS 信息，会返回占位值
+var smbiosPlaceholders = []string{
+	"to be filled by o.e.m.",
+	"default string",
+	"system serial number",
+	"not specified",
+	"none",
+	"0",
+	"00000000-0000-0000-0000-000000000000",
+	"ffffffff-ffff-ffff-ffff-ffffffffffff",
+	"03000200-0400-0500-0006-000700080009",
+}
+
+func cleanSMBIOSValue(s string) string {
+	s = strings.TrimSpace(s)
+	for _, p := range smbiosPlaceholders {
+		if strings.EqualFold(s, p) {
+			return ""
+		}
+	}
+	return s
+}
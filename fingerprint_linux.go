@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const sysClassNet = "/sys/class/net"
+
+func getMachineID() string {
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		if b, err := os.ReadFile(path); err == nil {
+			if id := strings.TrimSpace(string(b)); id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// 整机序列号和 UUID，普通用户无权读取时返回空
+func getSMBIOSInfo() (serial, uuid string) {
+	return readSysFile("/sys/class/dmi/id/product_serial"), readSysFile("/sys/class/dmi/id/product_uuid")
+}
+
+// 物理网卡：有对应的设备、不在 USB 总线上，且 MAC 为出厂地址（addr_assign_type 为 0）
+func persistentNICs() map[string]bool {
+	entries, err := os.ReadDir(sysClassNet)
+	if err != nil {
+		return nil
+	}
+	nics := map[string]bool{}
+	for _, e := range entries {
+		dir := filepath.Join(sysClassNet, e.Name())
+		if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+			continue // 虚拟网卡没有 device
+		}
+		if path, err := filepath.EvalSymlinks(dir); err != nil || strings.Contains(path, "/usb") {
+			continue
+		}
+		if readSysFile(filepath.Join(dir, "addr_assign_type")) != "0" {
+			continue
+		}
+		nics[e.Name()] = true
+	}
+	return nics
+}
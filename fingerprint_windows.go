@@ -0,0 +1,61 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/yusufpapurcu/wmi"
+	"golang.org/x/sys/windows/registry"
+)
+
+type win32ComputerSystemProduct struct {
+	IdentifyingNumber string
+	UUID              string
+}
+
+type win32NetworkAdapter struct {
+	NetConnectionID string
+	PNPDeviceID     string
+}
+
+// 非物理总线上的网卡：USB（扩展坞）、软件虚拟网卡、蓝牙
+var virtualNICPrefixes = []string{`USB\`, `ROOT\`, `SWD\`, `BTH`}
+
+func getMachineID() string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SOFTWARE\Microsoft\Cryptography`, registry.QUERY_VALUE|registry.WOW64_64KEY)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+	guid, _, err := k.GetStringValue("MachineGuid")
+	if err != nil {
+		return ""
+	}
+	return guid
+}
+
+// 整机序列号和 UUID
+func getSMBIOSInfo() (serial, uuid string) {
+	var products []win32ComputerSystemProduct
+	if err := wmi.Query("SELECT IdentifyingNumber, UUID FROM Win32_ComputerSystemProduct", &products); err != nil || len(products) == 0 {
+		return "", ""
+	}
+	return products[0].IdentifyingNumber, products[0].UUID
+}
+
+// 物理网卡，按连接名称（与 net.Interface.Name 一致）索引
+func persistentNICs() map[string]bool {
+	var adapters []win32NetworkAdapter
+	if err := wmi.Query("SELECT NetConnectionID, PNPDeviceID FROM Win32_NetworkAdapter WHERE PhysicalAdapter = TRUE", &adapters); err != nil {
+		return nil
+	}
+	nics := map[string]bool{}
+	for _, a := range adapters {
+		id := strings.ToUpper(a.PNPDeviceID)
+		if a.NetConnectionID == "" || slices.ContainsFunc(virtualNICPrefixes, func(p string) bool { return strings.HasPrefix(id, p) }) {
+			continue
+		}
+		nics[a.NetConnectionID] = true
+	}
+	return nics
+}
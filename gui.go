@@ -1,3 +1,5 @@
+//go:build windows && !headless
+
 // Copyright 2013 The Walk Authors. All rights reserved.
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
@@ -37,7 +39,7 @@ func startServerGUI(interval int) {
 	var detailView *walk.TextEdit
 	model := NewClientInfoModel(interval)
 
-	// 从 rsrc.syso 中加载图标
+	// 从 rsrc_windows_amd64.syso 中加载图标
 	icon, err := walk.NewIconFromResourceId(2)
 	if err != nil {
 		log.Fatalln("图标加载失败:", err)
@@ -141,18 +143,22 @@ func startServerGUI(interval int) {
 							}
 							// 勾选行内容导出
 							outputRow := 2 // 表格内容起始行
+							var checkedClients []ClientInfo
 							for row := range model.RowCount() {
-								if checked := model.items[row].Checked; checked {
+								if item := model.items[row]; item.Checked {
 									for col := range model.ColumnCount() {
 										value := model.Value(row, col)
 										f.SetCellValue(sheet, fmt.Sprintf("%s%d", columnLetter(col), outputRow), value)
 									}
+									checkedClients = append(checkedClients, ClientInfo{HostID: item.HostID, Hostname: item.Hostname, Interfaces: item.Interfaces})
+									writeAudit("gui", auditExport, item.HostID, "", "")
 									outputRow++
 								}
 							}
 							if outputRow == 2 {
 								walk.MsgBox(serverWin, "提示", "未勾选任何行", walk.MsgBoxIconWarning)
 							} else {
+								writeInterfaceSheet(f, checkedClients)
 								if err := f.SaveAs("导出.xlsx"); err != nil {
 									walk.MsgBox(serverWin, "错误", "保存失败: "+err.Error(), walk.MsgBoxIconError)
 								} else {
@@ -162,6 +168,74 @@ func startServerGUI(interval int) {
 
 						},
 					},
+					d.PushButton{
+						Text:    "合并",
+						MinSize: d.Size{Width: 80, Height: 40},
+						MaxSize: d.Size{Width: 80, Height: 40},
+
+						OnClicked: func() {
+							// 勾选的记录合并到最近上报的一条
+							var checked []*ClientInfoTable
+							for _, item := range model.items {
+								if item.Checked {
+									checked = append(checked, item)
+								}
+							}
+							if len(checked) < 2 {
+								walk.MsgBox(serverWin, "提示", "请至少勾选两条记录", walk.MsgBoxIconWarning)
+								return
+							}
+							keep := checked[0]
+							for _, item := range checked[1:] {
+								if updatedBefore(keep.Updated, item.Updated) {
+									keep = item
+								}
+							}
+							message := fmt.Sprintf("将勾选的 %d 条记录合并到 %v（%v），是否继续？", len(checked), keep.Hostname, keep.HostID)
+							if walk.MsgBox(serverWin, "合并", message, walk.MsgBoxYesNo|walk.MsgBoxIconQuestion) != walk.DlgCmdYes {
+								return
+							}
+							for _, item := range checked {
+								if item == keep {
+									continue
+								}
+								if err := mergeHosts(keep.HostID, item.HostID); err != nil {
+									walk.MsgBox(serverWin, "错误", "合并失败: "+err.Error(), walk.MsgBoxIconError)
+									return
+								}
+								writeAudit("gui", auditMerge, item.HostID, "merged into "+keep.HostID, "")
+								log.Printf("【Server】 已将记录 %v 合并到 %v\n", item.HostID, keep.HostID)
+							}
+							walk.MsgBox(serverWin, "成功", "合并成功，请重置刷新", walk.MsgBoxIconInformation)
+						},
+					},
+					d.PushButton{
+						Text:    "立即采集",
+						MinSize: d.Size{Width: 80, Height: 40},
+						MaxSize: d.Size{Width: 80, Height: 40},
+
+						OnClicked: func() {
+							// 为勾选的记录下发采集任务，客户端下次领取任务时执行
+							n := 0
+							for _, item := range model.items {
+								if !item.Checked {
+									continue
+								}
+								id, err := addTask(item.HostID, taskCollect, nil)
+								if err != nil {
+									walk.MsgBox(serverWin, "错误", "下发任务失败: "+err.Error(), walk.MsgBoxIconError)
+									return
+								}
+								writeAudit("gui", auditTask, item.HostID, fmt.Sprintf("#%d %v", id, taskCollect), "")
+								n++
+							}
+							if n == 0 {
+								walk.MsgBox(serverWin, "提示", "请勾选记录", walk.MsgBoxIconWarning)
+								return
+							}
+							walk.MsgBox(serverWin, "成功", fmt.Sprintf("已下发 %d 个采集任务", n), walk.MsgBoxIconInformation)
+						},
+					},
 					d.HSpacer{}, // 把剩余空间推到右边
 					d.PushButton{
 						Text:     "重置刷新",
@@ -229,6 +303,7 @@ func startServerGUI(interval int) {
 							{Title: model.ColumnName(6), Width: 60},
 							{Title: model.ColumnName(7), Width: 60},
 							{Title: model.ColumnName(8), Width: 50},
+							{Title: model.ColumnName(9), Width: 60},
 						},
 						StyleCell: func(style *walk.CellStyle) {
 							if style.Row() < 0 || style.Row() >= len(model.items) {
@@ -253,7 +328,7 @@ func startServerGUI(interval int) {
 						OnMouseMove: func(x, y int, button walk.MouseButton) {
 							detailView.SetCursor(walk.CursorArrow()) // 更改鼠标样式
 						},
-						Text:          "\r\nComputer Information Collect\r\n\r\nVersion 1.0.0\r\n\r\n©2025 Powerd By Kecho\r\n",
+						Text:          "\r\nComputer Information Collect\r\n\r\nVersion " + appVersion + "\r\n\r\n©2025 Powerd By Kecho\r\n",
 						VScroll:       true,
 						HScroll:       true,
 						Font:          d.Font{Family: "Consolas", PointSize: 14},
@@ -479,6 +554,7 @@ func startServerGUI(interval int) {
 			detailView.SetFont(font)
 
 			item := model.items[row]
+			writeAudit("gui", auditView, item.HostID, "", "")
 
 			var b strings.Builder
 			val := reflect.ValueOf(item)
@@ -490,7 +566,7 @@ func startServerGUI(interval int) {
 			if val.Kind() != reflect.Struct {
 				return
 			}
-			width := 12
+			width := 14
 			for i := range val.NumField() {
 				field := typ.Field(i)
 				if field.PkgPath != "" {
@@ -499,23 +575,47 @@ func startServerGUI(interval int) {
 				if field.Name == "ID" || field.Name == "Checked" || field.Name == "Online" {
 					continue
 				}
-				if field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String {
-					// 是 [] string 类型
-					slice := val.Field(i).Interface().([]string)
-					if len(slice) == 0 {
+				if field.Type.Kind() == reflect.Slice {
+					// 切片类型，每个元素一行（元素为结构体时使用其 String 方法）
+					slice := val.Field(i)
+					if slice.Len() == 0 {
 						fmt.Fprintf(&b, "%-*s: \r\n", width, field.Name)
 					} else {
-						fmt.Fprintf(&b, "%-*s: %s\r\n", width, field.Name, slice[0]) // 第一行
-						indent := strings.Repeat(" ", width+2)                       // 冒号后面空格数，第二行之后行的前缀
-						for _, v := range slice[1:] {
+						fmt.Fprintf(&b, "%-*s: %v\r\n", width, field.Name, slice.Index(0).Interface()) // 第一行
+						indent := strings.Repeat(" ", width+2)                                         // 冒号后面空格数，第二行之后行的前缀
+						for j := 1; j < slice.Len(); j++ {
 							b.WriteString(indent)
-							b.WriteString(v)
+							b.WriteString(fmt.Sprint(slice.Index(j).Interface()))
 							b.WriteString("\r\n")
 						}
 					}
-				} else { // string 类型
+				} else { // string 和容量等类型
 					v := val.Field(i).Interface()
-					fmt.Fprintf(&b, "%-*s: %s\r\n", width, field.Name, v)
+					fmt.Fprintf(&b, "%-*s: %v\r\n", width, field.Name, v)
+				}
+			}
+			// 最近的变更事件
+			events, err := queryHostEvents(item.HostID, 50, 0)
+			if err != nil {
+				log.Println("【Server】", err)
+			}
+			if len(events) > 0 {
+				fmt.Fprintf(&b, "\r\n%-*s:\r\n", width, "Changes")
+				for _, e := range events {
+					b.WriteString(e.String())
+					b.WriteString("\r\n")
+				}
+			}
+			// 最近的任务
+			tasks, err := queryTasks(item.HostID, 20)
+			if err != nil {
+				log.Println("【Server】", err)
+			}
+			if len(tasks) > 0 {
+				fmt.Fprintf(&b, "\r\n%-*s:\r\n", width, "Tasks")
+				for _, t := range tasks {
+					b.WriteString(t.String())
+					b.WriteString("\r\n")
 				}
 			}
 			detailView.SetText(b.String())
@@ -536,16 +636,6 @@ func getExecutableName() string {
 
 }
 
-// 转换为 xlsx 单元格格式，如将 0 转 A, ... , 26 转 AA
-func columnLetter(col int) string {
-	result := ""
-	for col >= 0 {
-		result = string(rune('A'+(col%26))) + result
-		col = col/26 - 1
-	}
-	return result
-}
-
 // 计算总页数
 func getPageCount(total, pageSize int) int {
 	if total == 0 {
@@ -586,7 +676,7 @@ func resetDetailView(view *walk.TextEdit) {
 	view.SetFont(font)
 
 	view.SetTextAlignment(walk.AlignCenter)
-	view.SetText("\r\nComputer Information Collect\r\n\r\nVersion 1.0.0\r\n\r\n©2025 Powerd By Kecho\r\n")
+	view.SetText("\r\nComputer Information Collect\r\n\r\nVersion " + appVersion + "\r\n\r\n©2025 Powerd By Kecho\r\n")
 }
 
 // func loadIconFromEmbed() (*walk.Icon, error) {
@@ -0,0 +1,10 @@
+//go:build !windows || headless
+
+package main
+
+import "log"
+
+// 非 Windows 平台不支持 walk 图形界面
+func startServerGUI(interval int) {
+	log.Println("【Server】", "当前平台不支持图形界面，仅提供数据收集服务")
+}
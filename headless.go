@@ -0,0 +1,25 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// 无界面运行服务端，适用于 Linux 守护进程等场景
+// 收到 SIGINT/SIGTERM 后等待处理中的请求完成，关闭数据库并退出
+func startHeadlessServer(opts ServerOptions) {
+	startCollectService(opts)
+
+	log.Println("【Server】", "收到退出信号:", <-exitSignal())
+	stopCollectService()
+	log.Println("【Server】", "程序退出")
+}
+
+// 服务端退出信号
+func exitSignal() <-chan os.Signal {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	return sig
+}
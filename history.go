@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 历史快照，内容相同的连续上报合并为一条，记录首次和最后一次上报时间
+type HostSnapshot struct {
+	ID        int64      `json:"id"`
+	FirstSeen string     `json:"first_seen"`
+	LastSeen  string     `json:"last_seen"`
+	Info      ClientInfo `json:"info"`
+}
+
+// 快照去重时忽略上报时间以及内存、磁盘的实时用量，否则每次上报都会产生新快照
+func snapshotHash(data ClientInfo) string {
+	data.Updated, data.Endpoint = "", ""
+	data.MemoryUsed, data.MemoryFree = 0, 0
+	data.DiskUsed, data.DiskFree = 0, 0
+	volumes := make([]Volume, len(data.Volumes))
+	for i, v := range data.Volumes {
+		v.Used, v.Free = 0, 0
+		volumes[i] = v
+	}
+	data.Volumes = volumes
+
+	b, _ := json.Marshal(data)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// 与该主机最新的快照内容相同时只更新最后上报时间，否则新增一条
+func saveSnapshot(tx *sql.Tx, data ClientInfo) error {
+	hash := snapshotHash(data)
+
+	var id int64
+	var lastHash string
+	err := tx.QueryRow("SELECT id, hash FROM client_snapshot WHERE host_id = ? ORDER BY julianday(first_seen) DESC, id DESC LIMIT 1", data.HostID).Scan(&id, &lastHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil && lastHash == hash {
+		_, err = tx.Exec("UPDATE client_snapshot SET last_seen = ? WHERE id = ?", data.Updated, id)
+		return err
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO client_snapshot (host_id, hash, data, first_seen, last_seen) VALUES (?,?,?,?,?)",
+		data.HostID, hash, string(b), data.Updated, data.Updated)
+	return err
+}
+
+// a 的上报时间是否早于 b，客户端时区可能不同，需解析后比较
+func reportedBefore(a, b ClientInfo) bool {
+	return updatedBefore(a.Updated, b.Updated)
+}
+
+// RFC3339 时间 a 是否早于 b，任一方无法解析时返回 false
+func updatedBefore(a, b string) bool {
+	ta, err := time.Parse(time.RFC3339, a)
+	if err != nil {
+		return false
+	}
+	tb, err := time.Parse(time.RFC3339, b)
+	if err != nil {
+		return false
+	}
+	return ta.Before(tb)
+}
+
+// 插入补报的旧数据：与所在时间点的快照内容相同时只延长其时间范围，否则在该时间点新增一条
+// 各客户端的时区可能不同，时间按 julianday 比较
+func saveBackdatedSnapshot(tx *sql.Tx, data ClientInfo) error {
+	hash := snapshotHash(data)
+
+	var id int64
+	var prevHash string
+	err := tx.QueryRow(`SELECT id, hash FROM client_snapshot
+			WHERE host_id = ? AND julianday(first_seen) <= julianday(?)
+			ORDER BY julianday(first_seen) DESC, id DESC LIMIT 1`,
+		data.HostID, data.Updated).Scan(&id, &prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if err == nil && prevHash == hash {
+		_, err = tx.Exec("UPDATE client_snapshot SET last_seen = ? WHERE id = ? AND julianday(last_seen) < julianday(?)", data.Updated, id, data.Updated)
+		return err
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO client_snapshot (host_id, hash, data, first_seen, last_seen) VALUES (?,?,?,?,?)",
+		data.HostID, hash, string(b), data.Updated, data.Updated)
+	return err
+}
+
+func scanSnapshot(row rowScanner) (HostSnapshot, error) {
+	var s HostSnapshot
+	var data string
+	if err := row.Scan(&s.ID, &s.FirstSeen, &s.LastSeen, &data); err != nil {
+		return s, err
+	}
+	if err := json.Unmarshal([]byte(data), &s.Info); err != nil {
+		return s, fmt.Errorf("快照 %d 解析失败: %v", s.ID, err)
+	}
+	return s, nil
+}
+
+// 分页查询主机的历史快照，按时间倒序
+func queryHostHistory(hostID string, limit, offset int) ([]HostSnapshot, error) {
+	rows, err := db.Query(`SELECT id, first_seen, last_seen, data
+			FROM client_snapshot
+			WHERE host_id = ?
+			ORDER BY julianday(first_seen) DESC, id DESC
+			LIMIT ? OFFSET ?`, hostID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("历史查询失败: %v", err)
+	}
+	defer rows.Close()
+
+	var snapshots []HostSnapshot
+	for rows.Next() {
+		s, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, fmt.Errorf("历史查询解析错误: %v", err)
+		}
+		snapshots = append(snapshots, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("历史查询遍历错误: %v", err)
+	}
+	return snapshots, nil
+}
+
+// 主机的历史快照总数
+func queryHostHistoryTotal(hostID string) (int, error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM client_snapshot WHERE host_id = ?", hostID).Scan(&total); err != nil {
+		return 0, fmt.Errorf("查询历史总数失败: %v", err)
+	}
+	return total, nil
+}
+
+// 查询主机在指定时间（RFC3339）的状态，即该时间之前最近的一份快照
+func queryHostSnapshotAt(hostID, at string) (HostSnapshot, error) {
+	row := db.QueryRow(`SELECT id, first_seen, last_seen, data
+			FROM client_snapshot
+			WHERE host_id = ? AND julianday(first_seen) <= julianday(?)
+			ORDER BY julianday(first_seen) DESC, id DESC
+			LIMIT 1`, hostID, at)
+	return scanSnapshot(row)
+}
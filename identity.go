@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// 主机身份识别结果，保存在 host_identity.flag 和 client_info.identity_flag 中
+const (
+	identityClone     = "clone"     // 同一 agent ID 出现在不同硬件上（克隆时复制了客户端数据目录）
+	identityCollision = "collision" // 不同硬件上报了相同的 HostID（未 sysprep 的克隆虚拟机等）
+	identityReimaged  = "reimaged"  // 同一硬件重装系统后生成了新的 agent ID
+)
+
+// 根据 agent ID 和硬件指纹确定上报数据归属的记录，必要时改写 data.HostID
+//
+//  1. agent ID 和硬件都已知：归属原记录
+//  2. agent ID 已知但硬件标识变化：硬件确实冲突时判定为克隆，新建记录并标记双方；
+//     否则视为更换网卡、以 root 运行后可读取 SMBIOS 等情况，原记录更新硬件标识
+//  3. agent ID 未知但硬件已知：判定为重装，归属原记录
+//  4. 全新机器但 HostID 已被其他硬件占用：判定为冲突，新建记录并标记双方
+//
+// 旧版客户端不上报 agent ID，直接使用 HostID
+// 在保存数据的事务中执行，识别失败时整个上报失败
+func resolveHostIdentity(tx *sql.Tx, data *ClientInfo) error {
+	if data.AgentID == "" {
+		return nil
+	}
+	hwKey := data.Fingerprint.hardwareKey()
+	fpJson, _ := json.Marshal(data.Fingerprint)
+	now := time.Now().Format(time.RFC3339)
+
+	var hostID, flag string
+	err := tx.QueryRow("SELECT host_id, flag FROM host_identity WHERE agent_id = ? AND hardware_key = ?", data.AgentID, hwKey).Scan(&hostID, &flag)
+	if err == nil {
+		_, err = tx.Exec("UPDATE host_identity SET fingerprint = ?, reported_host_id = ?, last_seen = ? WHERE agent_id = ? AND hardware_key = ?",
+			string(fpJson), data.HostID, now, data.AgentID, hwKey)
+		data.HostID, data.IdentityFlag = hostID, flag
+		return err
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	known, err := queryAgentIdentities(tx, data.AgentID)
+	if err != nil {
+		return err
+	}
+	for _, r := range known {
+		if r.fingerprint.conflictsWith(data.Fingerprint) {
+			continue
+		}
+		_, err = tx.Exec("UPDATE host_identity SET hardware_key = ?, fingerprint = ?, reported_host_id = ?, last_seen = ? WHERE id = ?",
+			hwKey, string(fpJson), data.HostID, now, r.id)
+		if err != nil {
+			return err
+		}
+		log.Printf("【Server】 记录 %v 的硬件标识变化: %v -> %v\n", r.hostID, r.hwKey, hwKey)
+		data.HostID, data.IdentityFlag = r.hostID, r.flag
+		return nil
+	}
+
+	if len(known) > 0 {
+		hostID, flag = derivedHostID(data.HostID, data.AgentID, hwKey), identityClone
+		if err := setIdentityFlag(tx, known[0].hostID, identityClone); err != nil {
+			return err
+		}
+	} else {
+		hostID, flag, err = resolveNewAgent(tx, data, hwKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`INSERT INTO host_identity
+			(agent_id, hardware_key, host_id, reported_host_id, fingerprint, flag, first_seen, last_seen)
+		VALUES
+			(?,?,?,?,?,?,?,?)`,
+		data.AgentID, hwKey, hostID, data.HostID, string(fpJson), flag, now, now)
+	if err != nil {
+		return err
+	}
+	if flag != "" {
+		log.Printf("【Server】 主机身份异常 %v: 上报 HostID %v，agent %v，归属记录 %v\n", flag, data.HostID, data.AgentID, hostID)
+	}
+	data.HostID, data.IdentityFlag = hostID, flag
+	return nil
+}
+
+type agentIdentity struct {
+	id          int64
+	hostID      string
+	hwKey       string
+	flag        string
+	fingerprint HostFingerprint
+}
+
+// agent 已登记的所有硬件，最近上报的在前
+func queryAgentIdentities(tx *sql.Tx, agentID string) ([]agentIdentity, error) {
+	rows, err := tx.Query("SELECT id, host_id, hardware_key, flag, fingerprint FROM host_identity WHERE agent_id = ? ORDER BY last_seen DESC", agentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []agentIdentity
+	for rows.Next() {
+		var r agentIdentity
+		var fpJson string
+		if err := rows.Scan(&r.id, &r.hostID, &r.hwKey, &r.flag, &fpJson); err != nil {
+			return nil, err
+		}
+		json.Unmarshal([]byte(fpJson), &r.fingerprint)
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// 首次出现的 agent ID
+func resolveNewAgent(tx *sql.Tx, data *ClientInfo, hwKey string) (hostID, flag string, err error) {
+	if hwKey != "" {
+		err = tx.QueryRow("SELECT host_id FROM host_identity WHERE hardware_key = ? ORDER BY last_seen DESC LIMIT 1", hwKey).Scan(&hostID)
+		if err == nil {
+			return hostID, identityReimaged, nil
+		}
+		if err != sql.ErrNoRows {
+			return "", "", err
+		}
+	}
+
+	var used bool
+	err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM host_identity WHERE host_id = ?)", data.HostID).Scan(&used)
+	if err != nil {
+		return "", "", err
+	}
+	if !used {
+		return data.HostID, "", nil // 新机器，或旧版客户端升级后首次上报
+	}
+	if err := setIdentityFlag(tx, data.HostID, identityCollision); err != nil {
+		return "", "", err
+	}
+	return derivedHostID(data.HostID, data.AgentID, hwKey), identityCollision, nil
+}
+
+// 为克隆或冲突的机器生成新的记录 ID，同一 agent 和硬件始终得到相同的结果
+func derivedHostID(hostID, agentID, hwKey string) string {
+	sum := sha256.Sum256([]byte(agentID + "|" + hwKey))
+	return hostID + "#" + hex.EncodeToString(sum[:4])
+}
+
+func setIdentityFlag(ex dbExecutor, hostID, flag string) error {
+	if _, err := ex.Exec("UPDATE host_identity SET flag = ? WHERE host_id = ?", flag, hostID); err != nil {
+		return err
+	}
+	_, err := ex.Exec("UPDATE client_info SET identity_flag = ? WHERE host_id = ?", flag, hostID)
+	return err
+}
+
+// 合并记录：drop 的所有 agent、历史快照、变更事件和任务归属到 keep，删除 drop 的记录，并清除异常标记
+// drop 的分组和主机配置在 keep 没有时转给 keep，否则删除
+func mergeHosts(keep, drop string) error {
+	if keep == drop {
+		return fmt.Errorf("不能合并同一条记录")
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []struct {
+		query string
+		args  []any
+	}{
+		{"UPDATE host_identity SET host_id = ?, flag = '' WHERE host_id IN (?, ?)", []any{keep, keep, drop}},
+		{"UPDATE client_snapshot SET host_id = ? WHERE host_id = ?", []any{keep, drop}},
+		{"UPDATE host_event SET host_id = ? WHERE host_id = ?", []any{keep, drop}},
+		{"UPDATE agent_task SET host_id = ? WHERE host_id = ?", []any{keep, drop}},
+		{"UPDATE OR IGNORE host_group SET host_id = ? WHERE host_id = ?", []any{keep, drop}},
+		{"DELETE FROM host_group WHERE host_id = ?", []any{drop}},
+		{"UPDATE OR IGNORE agent_config SET name = ? WHERE scope = ? AND name = ?", []any{keep, configScopeHost, drop}},
+		{"DELETE FROM agent_config WHERE scope = ? AND name = ?", []any{configScopeHost, drop}},
+		{"DELETE FROM client_info WHERE host_id = ?", []any{drop}},
+		{"UPDATE client_info SET identity_flag = '' WHERE host_id = ?", []any{keep}},
+	}
+	for _, s := range stmts {
+		if _, err := tx.Exec(s.query, s.args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// 删除记录及其历史快照、变更事件、任务和身份，客户端再次上报时重新建立记录
+func deleteHost(hostID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM client_info WHERE host_id = ?", hostID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	for _, table := range []string{"client_snapshot", "host_event", "agent_task", "host_identity", "host_group"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE host_id = ?", hostID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM agent_config WHERE scope = ? AND name = ?", configScopeHost, hostID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 拆分记录：将指定 agent 从记录中移出，该 agent 下次上报时生成独立的记录
+func splitHost(hostID, agentID string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var total int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM host_identity WHERE host_id = ?", hostID).Scan(&total); err != nil {
+		return err
+	}
+	rows, err := tx.Query("SELECT id, hardware_key FROM host_identity WHERE host_id = ? AND agent_id = ?", hostID, agentID)
+	if err != nil {
+		return err
+	}
+	type identityRow struct {
+		id    int64
+		hwKey string
+	}
+	var moved []identityRow
+	for rows.Next() {
+		var r identityRow
+		if err := rows.Scan(&r.id, &r.hwKey); err != nil {
+			rows.Close()
+			return err
+		}
+		moved = append(moved, r)
+	}
+	rows.Close()
+	if len(moved) == 0 {
+		return fmt.Errorf("记录 %v 中没有 agent %v", hostID, agentID)
+	}
+	if len(moved) == total {
+		return fmt.Errorf("记录 %v 只包含 agent %v，无需拆分", hostID, agentID)
+	}
+
+	for _, r := range moved {
+		newID := derivedHostID(hostID, agentID, r.hwKey)
+		if _, err := tx.Exec("UPDATE host_identity SET host_id = ?, flag = '' WHERE id = ?", newID, r.id); err != nil {
+			return err
+		}
+	}
+	// 剩余的 agent 不再冲突
+	if _, err := tx.Exec("UPDATE host_identity SET flag = '' WHERE host_id = ?", hostID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE client_info SET identity_flag = '' WHERE host_id = ?", hostID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 命令行执行合并、拆分或清除标记，合并和拆分的参数格式为 "保留的 HostID,合并的 HostID" 和 "HostID,agent ID"
+func runIdentityCommand(merge, split, clear string) {
+	if err := initDataBase(); err != nil {
+		log.Fatalln("【Server】", err)
+	}
+	defer closeDataBase()
+
+	if merge != "" {
+		keep, drop, ok := strings.Cut(merge, ",")
+		if !ok {
+			log.Fatalln("【Server】", "参数格式错误:", merge)
+		}
+		if err := mergeHosts(strings.TrimSpace(keep), strings.TrimSpace(drop)); err != nil {
+			log.Fatalln("【Server】", "合并记录失败:", err)
+		}
+		writeAudit("cli", auditMerge, strings.TrimSpace(drop), "merged into "+strings.TrimSpace(keep), "")
+		log.Printf("【Server】 已将记录 %v 合并到 %v\n", drop, keep)
+	}
+	if split != "" {
+		hostID, agentID, ok := strings.Cut(split, ",")
+		if !ok {
+			log.Fatalln("【Server】", "参数格式错误:", split)
+		}
+		if err := splitHost(strings.TrimSpace(hostID), strings.TrimSpace(agentID)); err != nil {
+			log.Fatalln("【Server】", "拆分记录失败:", err)
+		}
+		writeAudit("cli", auditSplit, strings.TrimSpace(hostID), "split agent "+strings.TrimSpace(agentID), "")
+		log.Printf("【Server】 已将 agent %v 从记录 %v 中拆分\n", agentID, hostID)
+	}
+	if clear != "" {
+		// 确认无误后清除异常标记
+		if err := setIdentityFlag(db, clear, ""); err != nil {
+			log.Fatalln("【Server】", "清除标记失败:", err)
+		}
+		writeAudit("cli", auditClearFlag, clear, "", "")
+		log.Printf("【Server】 已清除记录 %v 的异常标记\n", clear)
+	}
+}
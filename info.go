@@ -1,15 +1,187 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
 type ClientInfo struct {
-	HostID       string   `json:"host_id"`
-	Hostname     string   `json:"hostname"`
-	Username     string   `json:"username"`
-	OS           string   `json:"os"`
-	CPU          string   `json:"cpu"`
-	Memory       string   `json:"memory"`
-	Disk         string   `json:"disk"`
-	IPAddresses  []string `json:"ip_addresses"`
-	MACAddresses []string `json:"mac_addresses"`
-	Programs     []string `json:"programs"`
-	Updated      string   `json:"updated"`
+	HostID        string          `json:"host_id"`
+	AgentID       string          `json:"agent_id"`
+	Fingerprint   HostFingerprint `json:"fingerprint"`
+	IdentityFlag  string          `json:"identity_flag,omitempty"` // 服务端识别结果，见 identity.go
+	Hostname      string          `json:"hostname"`
+	Username      string          `json:"username"`
+	OS            string          `json:"os"`
+	CPU           string          `json:"cpu"`
+	MemoryTotal   ByteSize        `json:"memory_total"`
+	MemoryUsed    ByteSize        `json:"memory_used"`
+	MemoryFree    ByteSize        `json:"memory_free"` // 可用内存
+	DiskTotal     ByteSize        `json:"disk_total"`
+	DiskUsed      ByteSize        `json:"disk_used"`
+	DiskFree      ByteSize        `json:"disk_free"`
+	Volumes       []Volume        `json:"volumes"`
+	PhysicalDisks []PhysicalDisk  `json:"physical_disks"`
+	Interfaces    []NetInterface  `json:"interfaces"`
+	Gateways      []string        `json:"gateways"` // 默认网关
+	DNSServers    []string        `json:"dns_servers"`
+	IPAddresses   []string        `json:"ip_addresses"`  // 由 Interfaces 汇总的 IPv4 地址，兼容旧版
+	MACAddresses  []string        `json:"mac_addresses"` // 由 Interfaces 汇总的已连接网卡 MAC 地址，兼容旧版
+	Programs      ProgramList     `json:"programs"`
+	Updated       string          `json:"updated"`
+	Endpoint      string          `json:"endpoint,omitempty"`      // 接收数据的服务端地址
+	AgentVersion  string          `json:"agent_version,omitempty"` // 客户端版本，旧版客户端不上报
+
+	// 旧版客户端上报的格式化容量，如 8.25 GB，仅用于兼容
+	Memory string `json:"memory,omitempty"`
+	Disk   string `json:"disk,omitempty"`
+
+	// 按服务端配置未采集的项目，服务端保存时沿用上次的数据
+	Skipped []string `json:"skipped,omitempty"`
+
+	// 离线缓存补报的数据，服务端据此判断是否只补充到历史快照，不保存
+	Replayed bool `json:"replayed,omitempty"`
+}
+
+// 将旧版客户端上报的格式化容量转换为字节数
+func (c *ClientInfo) normalize() {
+	if c.MemoryTotal == 0 && c.Memory != "" {
+		c.MemoryTotal = parseBytes(c.Memory)
+	}
+	if c.DiskTotal == 0 && c.Disk != "" {
+		c.DiskTotal = parseBytes(c.Disk)
+	}
+	c.Memory, c.Disk = "", ""
+}
+
+// 客户端时钟超前或时间无效时以服务端接收时间为准
+// 否则当前记录停留在未来的时间，之后的上报都会被当作补报
+func (c *ClientInfo) clampUpdated(now time.Time) {
+	t, err := time.Parse(time.RFC3339, c.Updated)
+	if err != nil || t.After(now) {
+		c.Updated = now.Format(time.RFC3339)
+	}
+}
+
+// 未采集的项目沿用 old 中的数据
+func (c *ClientInfo) keepSkipped(old ClientInfo) {
+	for _, name := range c.Skipped {
+		switch name {
+		case collectorPrograms:
+			c.Programs = old.Programs
+		case collectorDisks:
+			c.PhysicalDisks = old.PhysicalDisks
+		case collectorNetwork:
+			c.Interfaces, c.Gateways, c.DNSServers = old.Interfaces, old.Gateways, old.DNSServers
+			c.IPAddresses, c.MACAddresses = old.IPAddresses, old.MACAddresses
+		}
+	}
+	c.Skipped = nil
+}
+
+// 分区 / 卷
+type Volume struct {
+	Mountpoint string   `json:"mountpoint"` // C:\ 或 /home
+	Device     string   `json:"device"`
+	Filesystem string   `json:"filesystem"`
+	Total      ByteSize `json:"total"`
+	Used       ByteSize `json:"used"`
+	Free       ByteSize `json:"free"`
+}
+
+func (v Volume) String() string {
+	return fmt.Sprintf("%s %s %s (共 %v，已用 %v，可用 %v)", v.Mountpoint, v.Device, v.Filesystem, v.Total, v.Used, v.Free)
+}
+
+// 物理磁盘
+type PhysicalDisk struct {
+	Name      string   `json:"name"` // sda 或 \\.\PHYSICALDRIVE0
+	Model     string   `json:"model"`
+	Serial    string   `json:"serial"`
+	Size      ByteSize `json:"size"`
+	MediaType string   `json:"media_type"` // HDD、SSD，无法判断时为空
+	Bus       string   `json:"bus"`        // sata、nvme、usb、virtio 等
+}
+
+func (d PhysicalDisk) String() string {
+	var extra []string
+	for _, v := range []string{d.MediaType, d.Bus, d.Serial} {
+		if v != "" {
+			extra = append(extra, v)
+		}
+	}
+	s := strings.Join(strings.Fields(fmt.Sprintf("%s %s %v", d.Name, d.Model, d.Size)), " ")
+	if len(extra) > 0 {
+		s += " (" + strings.Join(extra, ", ") + ")"
+	}
+	return s
+}
+
+// 网卡
+type NetInterface struct {
+	Name string   `json:"name"`
+	MAC  string   `json:"mac"`
+	Up   bool     `json:"up"`
+	MTU  int      `json:"mtu"`
+	IPv4 []string `json:"ipv4"` // 带前缀长度，如 192.168.1.10/24
+	IPv6 []string `json:"ipv6"`
+}
+
+func (n NetInterface) String() string {
+	state := "down"
+	if n.Up {
+		state = "up"
+	}
+	addrs := append(append([]string{}, n.IPv4...), n.IPv6...)
+	return strings.Join(strings.Fields(fmt.Sprintf("%s %s %s MTU %d %s", n.Name, n.MAC, state, n.MTU, strings.Join(addrs, " "))), " ")
+}
+
+// 已安装软件
+type Program struct {
+	Name            string `json:"name"`
+	Version         string `json:"version,omitempty"`
+	Publisher       string `json:"publisher,omitempty"`
+	InstallDate     string `json:"install_date,omitempty"` // 2006-01-02
+	InstallLocation string `json:"install_location,omitempty"`
+	Architecture    string `json:"architecture,omitempty"`
+	Source          string `json:"source,omitempty"` // 注册表位置或包管理器，如 HKLM、dpkg、rpm
+}
+
+func (p Program) String() string {
+	s := p.Name
+	if p.Version != "" {
+		s += " " + p.Version
+	}
+	var extra []string
+	for _, v := range []string{p.Publisher, p.InstallDate, p.Source} {
+		if v != "" {
+			extra = append(extra, v)
+		}
+	}
+	if len(extra) > 0 {
+		s += " (" + strings.Join(extra, ", ") + ")"
+	}
+	return s
+}
+
+type ProgramList []Program
+
+// 兼容旧版客户端和数据库中仅包含软件名称的字符串数组
+func (l *ProgramList) UnmarshalJSON(data []byte) error {
+	var programs []Program
+	if err := json.Unmarshal(data, &programs); err == nil {
+		*l = programs
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*l = make(ProgramList, 0, len(names))
+	for _, name := range names {
+		*l = append(*l, Program{Name: name})
+	}
+	return nil
 }
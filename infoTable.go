@@ -1,31 +1,45 @@
+//go:build windows && !headless
+
 package main
 
 import (
 	"fmt"
 	"log"
 	"sort"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/lxn/walk"
 )
 
 type ClientInfoTable struct {
-	ID           int
-	HostID       string
-	Hostname     string
-	Username     string
-	OS           string
-	CPU          string
-	Memory       string
-	Disk         string
-	IPAddresses  []string
-	MACAddresses []string
-	Programs     []string
-	Updated      string
-	Checked      bool
-	Online       bool
+	ID            int
+	HostID        string
+	AgentID       string
+	Fingerprint   HostFingerprint
+	IdentityFlag  string
+	Hostname      string
+	Username      string
+	OS            string
+	CPU           string
+	MemoryTotal   ByteSize
+	MemoryUsed    ByteSize
+	MemoryFree    ByteSize
+	DiskTotal     ByteSize
+	DiskUsed      ByteSize
+	DiskFree      ByteSize
+	Volumes       []Volume
+	PhysicalDisks []PhysicalDisk
+	Interfaces    []NetInterface
+	Gateways      []string
+	DNSServers    []string
+	IPAddresses   []string
+	MACAddresses  []string
+	Programs      ProgramList
+	Updated       string
+	Endpoint      string
+	AgentVersion  string
+	Checked       bool
+	Online        bool
 }
 type ClientInfoModel struct {
 	walk.TableModelBase
@@ -45,7 +59,7 @@ func NewClientInfoModel(interval int) *ClientInfoModel {
 	m.interval = interval
 	m.pageSize = 50 // 初始页面大小为 50
 	m.page = 1
-	m.colNames = []string{"ID", "HostID", "Hostname", "Username", "OS", "CPU", "Memory", "Disk", "Online"}
+	m.colNames = hostTableColumns
 	m.items = make([]*ClientInfoTable, 0)
 	total, err := queryClientInfoTotal()
 	m.totalCount = total
@@ -88,19 +102,33 @@ func (m *ClientInfoModel) loadDataByPage(limit, offset int) error {
 		}
 		online := time.Since(lastReport) <= time.Duration(interval)*time.Minute
 		m.items = append(m.items, &ClientInfoTable{ //append 会自动扩容
-			ID:           i + 1,
-			HostID:       clients[i].HostID,
-			Hostname:     clients[i].Hostname,
-			Username:     clients[i].Username,
-			OS:           clients[i].OS,
-			CPU:          clients[i].CPU,
-			Memory:       clients[i].Memory,
-			Disk:         clients[i].Disk,
-			IPAddresses:  clients[i].IPAddresses,
-			MACAddresses: clients[i].MACAddresses,
-			Programs:     clients[i].Programs,
-			Updated:      clients[i].Updated,
-			Online:       online,
+			ID:            i + 1,
+			HostID:        clients[i].HostID,
+			AgentID:       clients[i].AgentID,
+			Fingerprint:   clients[i].Fingerprint,
+			IdentityFlag:  clients[i].IdentityFlag,
+			Hostname:      clients[i].Hostname,
+			Username:      clients[i].Username,
+			OS:            clients[i].OS,
+			CPU:           clients[i].CPU,
+			MemoryTotal:   clients[i].MemoryTotal,
+			MemoryUsed:    clients[i].MemoryUsed,
+			MemoryFree:    clients[i].MemoryFree,
+			DiskTotal:     clients[i].DiskTotal,
+			DiskUsed:      clients[i].DiskUsed,
+			DiskFree:      clients[i].DiskFree,
+			Volumes:       clients[i].Volumes,
+			PhysicalDisks: clients[i].PhysicalDisks,
+			Interfaces:    clients[i].Interfaces,
+			Gateways:      clients[i].Gateways,
+			DNSServers:    clients[i].DNSServers,
+			IPAddresses:   clients[i].IPAddresses,
+			MACAddresses:  clients[i].MACAddresses,
+			Programs:      clients[i].Programs,
+			Updated:       clients[i].Updated,
+			Endpoint:      clients[i].Endpoint,
+			AgentVersion:  clients[i].AgentVersion,
+			Online:        online,
 		})
 	}
 	m.PublishRowsReset()
@@ -142,15 +170,17 @@ func (m *ClientInfoModel) Value(row, col int) any {
 	case 5:
 		return item.CPU
 	case 6:
-		return item.Memory
+		return item.MemoryTotal.String()
 	case 7:
-		return item.Disk
+		return item.DiskTotal.String()
 	case 8:
 		if item.Online {
 			return "On"
 		} else {
 			return "Off"
 		}
+	case 9:
+		return item.IdentityFlag
 	}
 
 	panic("unexpected col")
@@ -211,11 +241,13 @@ func (m *ClientInfoModel) Sort(col int, order walk.SortOrder) error {
 		case 5:
 			return c(a.CPU < b.CPU)
 		case 6:
-			return c(parseSizeToGB(a.Memory) < parseSizeToGB(b.Memory))
+			return c(a.MemoryTotal < b.MemoryTotal)
 		case 7:
-			return c(parseSizeToGB(a.Disk) < parseSizeToGB(b.Disk))
+			return c(a.DiskTotal < b.DiskTotal)
 		case 8:
 			return c(a.Online && !b.Online)
+		case 9:
+			return c(a.IdentityFlag < b.IdentityFlag)
 		}
 
 		panic("unreachable")
@@ -223,26 +255,3 @@ func (m *ClientInfoModel) Sort(col int, order walk.SortOrder) error {
 
 	return m.SorterBase.Sort(col, order)
 }
-
-// 容量单位转化为 GB 方便排序
-func parseSizeToGB(s string) float64 {
-	parts := strings.Fields(s) // "8.25 GB" -> ["8.25", "GB"]
-	if len(parts) != 2 {
-		return 0
-	}
-	val, err := strconv.ParseFloat(parts[0], 64)
-	if err != nil {
-		return 0
-	}
-	switch strings.ToUpper(parts[1]) {
-	case "TB":
-		return val * 1024
-	case "GB":
-		return val
-	case "MB":
-		return val / 1024
-	case "KB":
-		return val / 1024 / 1024
-	}
-	return val
-}
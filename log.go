@@ -9,11 +9,43 @@ import (
 	"time"
 )
 
+// 日志级别，由服务端下发的配置设置，目前只作用于客户端的常规输出
+const (
+	logLevelDebug = "debug"
+	logLevelInfo  = "info"
+	logLevelError = "error" // 只输出错误
+)
+
+var logLevel = logLevelInfo
+
+// 当前日志文件路径，用于上传日志
+var logFilePath string
+
+func setLogLevel(level string) {
+	if level == "" {
+		level = logLevelInfo
+	}
+	logLevel = level
+}
+
+func logInfo(v ...any) {
+	if logLevel != logLevelError {
+		log.Println(v...)
+	}
+}
+
+func logDebug(v ...any) {
+	if logLevel == logLevelDebug {
+		log.Println(v...)
+	}
+}
+
 func initLogger() *os.File {
 	now := time.Now()
 	logDir := "CInfoCollectLog"
 	logFileName := fmt.Sprintf("%04d-%02d.log", now.Year(), int(now.Month()))
 	logPath := filepath.Join(logDir, logFileName)
+	logFilePath = logPath
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		log.Fatalln("无法创建日志目录:", err)
 	}
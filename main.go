@@ -2,26 +2,101 @@ package main
 
 import (
 	"flag"
+	"path/filepath"
 )
 
+// 客户端上报时附带，界面中显示
+const appVersion = "1.0.0"
+
 func main() {
 	logFile := initLogger()
 	defer logFile.Close()
 
 	isServer := flag.Bool("s", false, "启动服务端")
 	isBackground := flag.Bool("b", false, "后台静默启动")
+	isHeadless := flag.Bool("headless", false, "服务端无界面运行（不启动托盘和图形界面）")
 	port := flag.Int("p", 9870, "监听端口")
-	serverIP := flag.String("ip", "collect.example.com", "服务端IP")
+	servers := flag.String("servers", "", "按优先级排列的服务端地址，逗号分隔，格式为 host[:port] 或完整 URL，当前服务端不可用时依次切换")
+	serverIP := flag.String("ip", "", "服务端IP，为空时通过 DNS SRV 或局域网广播自动发现")
 	interval := flag.Int("t", 2, "定时上报间隔（分钟）0 表示只执行一次")
+	mergeArg := flag.String("merge-host", "", "合并主机记录，格式：保留的HostID,被合并的HostID")
+	splitArg := flag.String("split-host", "", "从主机记录中拆分出指定客户端，格式：HostID,AgentID")
+	clearArg := flag.String("clear-flag", "", "清除主机记录的克隆、冲突等异常标记，参数为 HostID")
+	useTLS := flag.Bool("tls", false, "使用 HTTPS（服务端和客户端需同时启用）")
+	certFile := flag.String("cert", filepath.Join(dataDir, "server.crt"), "服务端证书路径")
+	keyFile := flag.String("key", filepath.Join(dataDir, "server.key"), "服务端私钥路径")
+	genCert := flag.Bool("gen-cert", false, "服务端证书不存在时生成自签名证书")
+	caFile := flag.String("ca", "", "客户端信任的 CA 证书路径，默认使用系统证书")
+	pin := flag.String("pin", "", "客户端只信任指定 SHA-256 指纹的服务端证书")
+	token := flag.String("enroll-token", "", "客户端注册令牌（服务端设置后要求客户端注册）")
+	revokeArg := flag.String("revoke-agent", "", "吊销客户端的密钥和证书，参数为 AgentID")
+	setConfig := flag.String("set-config", "", `设置下发给客户端的配置，格式：default=JSON、group:分组=JSON 或 host:HostID=JSON，如 default={"interval":5}`)
+	setGroup := flag.String("set-group", "", "设置主机所在分组，格式：HostID,分组（分组为空时移出分组）")
+	addTaskArg := flag.String("add-task", "", `向客户端下发任务，格式：HostID,类型[,JSON 参数]，类型可选 collect、collect_full、upload_logs、set_interval（参数如 {"interval":5}）`)
+	listTasksArg := flag.String("list-tasks", "", "查看任务状态，参数为 HostID，all 表示所有主机")
+	noDiscovery := flag.Bool("no-discovery", false, "服务端不应答客户端的局域网发现广播")
+	requireSign := flag.Bool("require-sign", false, "服务端拒绝未签名的上报（默认只拒绝已登记公钥的客户端的未签名上报）")
+	addUserArg := flag.String("add-user", "", "新增网页和查询接口的用户或重置其密码（随机生成并输出），格式：用户名[,角色]，角色可选 viewer、admin")
+	mtls := flag.Bool("mtls", false, "启用客户端证书认证（服务端签发证书，客户端自动注册）")
 	flag.Parse()
 
+	if *mergeArg != "" || *splitArg != "" || *clearArg != "" {
+		runIdentityCommand(*mergeArg, *splitArg, *clearArg)
+		return
+	}
+	if *revokeArg != "" {
+		runRevokeCommand(*revokeArg)
+		return
+	}
+	if *setConfig != "" || *setGroup != "" {
+		runConfigCommand(*setConfig, *setGroup)
+		return
+	}
+	if *addUserArg != "" {
+		runUserCommand(*addUserArg)
+		return
+	}
+	if *addTaskArg != "" || *listTasksArg != "" {
+		runTaskCommand(*addTaskArg, *listTasksArg)
+		return
+	}
+
 	if *isServer {
-		startServerWithTray(*port, *interval)
+		opts := ServerOptions{
+			Port:     *port,
+			Interval: *interval,
+			TLS:      *useTLS || *genCert || *mtls,
+			CertFile: *certFile,
+			KeyFile:  *keyFile,
+			GenCert:  *genCert,
+			MTLS:     *mtls,
+
+			EnrollToken:      *token,
+			RequireSignature: *requireSign,
+			Discovery:        !*noDiscovery,
+		}
+		if *isHeadless {
+			startHeadlessServer(opts)
+		} else {
+			startServerWithTray(opts)
+		}
 	} else {
+		opts := ClientOptions{
+			Port:     *port,
+			ServerIP: *serverIP,
+			Servers:  parseServerList(*servers),
+			Interval: *interval,
+			TLS:      *useTLS || *caFile != "" || *pin != "" || *mtls,
+			CAFile:   *caFile,
+			Pin:      *pin,
+			MTLS:     *mtls,
+
+			EnrollToken: *token,
+		}
 		if *isBackground {
-			startClient(*port, *serverIP, *interval)
+			startClient(opts)
 		} else {
-			startClientWithTray(*port, *serverIP, *interval)
+			startClientWithTray(opts)
 		}
 	}
 
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 上报处理结果，作为 cic_reports_received_total 的 result 标签
+const (
+	reportOK       = "ok"
+	reportInvalid  = "invalid"  // 读取请求体或解析 JSON 失败
+	reportRejected = "rejected" // 客户端认证或签名校验失败
+	reportDBError  = "db_error" // 保存到数据库失败，返回 503 由客户端重试
+)
+
+// 上报处理耗时的分桶上限（秒）
+var reportLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// 服务端运行指标，进程重启后清零
+var metrics = struct {
+	sync.Mutex
+	reports       map[string]uint64
+	decodeErrors  uint64
+	saveErrors    uint64
+	latencyCounts []uint64 // 与 reportLatencyBuckets 对应，最后一项为 +Inf
+	latencySum    float64
+	latencyCount  uint64
+}{
+	reports:       map[string]uint64{},
+	latencyCounts: make([]uint64, len(reportLatencyBuckets)+1),
+}
+
+var startTime = time.Now()
+
+// 记录一次上报的处理结果和耗时
+func observeReport(result string, start time.Time) {
+	d := time.Since(start).Seconds()
+	i := sort.SearchFloat64s(reportLatencyBuckets, d)
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.reports[result]++
+	metrics.latencyCounts[i]++
+	metrics.latencySum += d
+	metrics.latencyCount++
+	if result == reportDBError {
+		metrics.saveErrors++
+	}
+}
+
+func countDecodeError() {
+	metrics.Lock()
+	metrics.decodeErrors++
+	metrics.Unlock()
+}
+
+// Prometheus 文本格式的写入
+type metricsWriter struct {
+	w io.Writer
+}
+
+func (m metricsWriter) header(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (m metricsWriter) sample(name string, labels []string, value float64) {
+	if len(labels) > 0 {
+		var pairs []string
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, labels[i]+`="`+escapeLabel(labels[i+1])+`"`)
+		}
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(m.w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// 按列分组统计主机数，值为空时记为 unknown
+func countHostsBy(column string) (map[string]int, error) {
+	rows, err := db.Query(`SELECT ` + column + `, COUNT(*) FROM client_info GROUP BY ` + column)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	counts := map[string]int{}
+	for rows.Next() {
+		var value string
+		var n int
+		if err := rows.Scan(&value, &n); err != nil {
+			return nil, err
+		}
+		if value == "" {
+			value = "unknown"
+		}
+		counts[value] += n
+	}
+	return counts, rows.Err()
+}
+
+func writeHostCounts(m metricsWriter, name, label, help string, counts map[string]int) {
+	m.header(name, "gauge", help)
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		m.sample(name, []string{label, k}, float64(counts[k]))
+	}
+}
+
+// 主机数量在每次抓取时从数据库统计，查询失败时只输出运行指标
+func writeFleetMetrics(m metricsWriter) error {
+	// 在线判断与 queryHosts 一致
+	var total, online int
+	err := db.QueryRow(`SELECT COUNT(*), COUNT(CASE WHEN julianday(updated) >= julianday(?) THEN 1 END) FROM client_info`,
+		time.Now().Add(-onlineInterval).UTC().Format(time.RFC3339)).Scan(&total, &online)
+	if err != nil {
+		return err
+	}
+	byOS, err := countHostsBy("os")
+	if err != nil {
+		return err
+	}
+	byVersion, err := countHostsBy("agent_version")
+	if err != nil {
+		return err
+	}
+	m.header("cic_hosts", "gauge", "Number of hosts by online state.")
+	m.sample("cic_hosts", []string{"state", "online"}, float64(online))
+	m.sample("cic_hosts", []string{"state", "offline"}, float64(total-online))
+	writeHostCounts(m, "cic_hosts_by_os", "os", "Number of hosts by operating system.", byOS)
+	writeHostCounts(m, "cic_hosts_by_agent_version", "version", "Number of hosts by agent version, unknown for agents that do not report it.", byVersion)
+	return nil
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := metricsWriter{w}
+
+	// 加锁时只复制计数，写响应不占用锁，避免慢速抓取阻塞上报处理
+	results := []string{reportOK, reportInvalid, reportRejected, reportDBError}
+	reports := make([]uint64, len(results))
+	metrics.Lock()
+	for i, result := range results {
+		reports[i] = metrics.reports[result]
+	}
+	decodeErrors, saveErrors := metrics.decodeErrors, metrics.saveErrors
+	latencyCounts := slices.Clone(metrics.latencyCounts)
+	latencySum, latencyCount := metrics.latencySum, metrics.latencyCount
+	metrics.Unlock()
+
+	m.header("cic_reports_received_total", "counter", "Reports received by processing result.")
+	for i, result := range results {
+		m.sample("cic_reports_received_total", []string{"result", result}, float64(reports[i]))
+	}
+	m.header("cic_report_decode_errors_total", "counter", "Reports whose JSON body could not be decoded.")
+	m.sample("cic_report_decode_errors_total", nil, float64(decodeErrors))
+	m.header("cic_db_save_errors_total", "counter", "Reports that failed to be saved to the database.")
+	m.sample("cic_db_save_errors_total", nil, float64(saveErrors))
+	m.header("cic_report_duration_seconds", "histogram", "Time spent processing a report.")
+	var cumulative uint64
+	for i, le := range reportLatencyBuckets {
+		cumulative += latencyCounts[i]
+		m.sample("cic_report_duration_seconds_bucket", []string{"le", strconv.FormatFloat(le, 'g', -1, 64)}, float64(cumulative))
+	}
+	cumulative += latencyCounts[len(reportLatencyBuckets)]
+	m.sample("cic_report_duration_seconds_bucket", []string{"le", "+Inf"}, float64(cumulative))
+	m.sample("cic_report_duration_seconds_sum", nil, latencySum)
+	m.sample("cic_report_duration_seconds_count", nil, float64(latencyCount))
+
+	m.header("cic_start_time_seconds", "gauge", "Server start time in unix seconds.")
+	m.sample("cic_start_time_seconds", nil, float64(startTime.Unix()))
+	m.header("cic_build_info", "gauge", "Server version.")
+	m.sample("cic_build_info", []string{"version", appVersion}, 1)
+
+	if err := writeFleetMetrics(m); err != nil {
+		log.Println("【Server】", "统计主机数量失败:", err)
+	}
+}
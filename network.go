@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"net"
+	"strings"
+)
+
+// 网卡列表，忽略回环网卡，未连接的网卡也一并上报
+func getInterfaces() []NetInterface {
+	var result []NetInterface
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		log.Println("【Client】", "获取网络接口失败:", err)
+		return result
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		n := NetInterface{
+			Name: iface.Name,
+			MAC:  iface.HardwareAddr.String(),
+			Up:   iface.Flags&net.FlagUp != 0,
+			MTU:  iface.MTU,
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if ipNet.IP.To4() != nil {
+				n.IPv4 = append(n.IPv4, ipNet.String())
+			} else {
+				n.IPv6 = append(n.IPv6, ipNet.String())
+			}
+		}
+		result = append(result, n)
+	}
+	return result
+}
+
+// 汇总 IPv4 地址（不含前缀长度），过滤 169.254.x.x
+func ipAddressesOf(ifaces []NetInterface) []string {
+	var ips []string
+	for _, iface := range ifaces {
+		for _, cidr := range iface.IPv4 {
+			ip, _, _ := strings.Cut(cidr, "/")
+			if strings.HasPrefix(ip, "169.254.") {
+				continue
+			}
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		ips = append(ips, "unknown") // 防止数据库非空字段错误
+	}
+	return ips
+}
+
+// 汇总已连接网卡的 MAC 地址
+func macAddressesOf(ifaces []NetInterface) []string {
+	var macs []string
+	for _, iface := range ifaces {
+		if iface.MAC == "" || !iface.Up {
+			continue
+		}
+		macs = append(macs, iface.MAC)
+	}
+	if len(macs) == 0 {
+		macs = append(macs, "unknown") // 防止数据库非空字段错误
+	}
+	return macs
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	procRoutePath     = "/proc/net/route"
+	procIPv6RoutePath = "/proc/net/ipv6_route"
+	resolvConfPath    = "/etc/resolv.conf"
+	// systemd-resolved 使用本地 127.0.0.53 作为 DNS，实际上游服务器在此文件中
+	resolvedConfPath = "/run/systemd/resolve/resolv.conf"
+)
+
+// 默认网关，读取 /proc/net/route 和 /proc/net/ipv6_route 中目标为默认路由的条目
+func getGateways() []string {
+	var gateways []string
+	if f, err := os.Open(procRoutePath); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // 表头
+		for scanner.Scan() {
+			// Iface Destination Gateway Flags ...，地址为小端十六进制
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 3 || fields[1] != "00000000" || fields[2] == "00000000" {
+				continue
+			}
+			b, err := hex.DecodeString(fields[2])
+			if err != nil || len(b) != 4 {
+				continue
+			}
+			gateways = appendUnique(gateways, net.IPv4(b[3], b[2], b[1], b[0]).String())
+		}
+		f.Close()
+	}
+	if f, err := os.Open(procIPv6RoutePath); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			// 目标地址 前缀长度 源地址 前缀长度 下一跳 ...，地址为大端十六进制
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 5 || fields[1] != "00" || strings.Trim(fields[0], "0") != "" || strings.Trim(fields[4], "0") == "" {
+				continue
+			}
+			b, err := hex.DecodeString(fields[4])
+			if err != nil || len(b) != net.IPv6len {
+				continue
+			}
+			gateways = appendUnique(gateways, net.IP(b).String())
+		}
+		f.Close()
+	}
+	return gateways
+}
+
+// DNS 服务器，读取 resolv.conf 中的 nameserver
+func getDNSServers() []string {
+	servers := readNameservers(resolvConfPath)
+	if len(servers) == 1 && servers[0] == "127.0.0.53" {
+		if upstream := readNameservers(resolvedConfPath); len(upstream) > 0 {
+			return upstream
+		}
+	}
+	return servers
+}
+
+func readNameservers(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var servers []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = appendUnique(servers, fields[1])
+		}
+	}
+	return servers
+}
+
+// 本机的 DNS 域，读取 resolv.conf 中的 domain 和 search
+func getDNSDomains() []string {
+	f, err := os.Open(resolvConfPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && (fields[0] == "domain" || fields[0] == "search") {
+			for _, d := range fields[1:] {
+				if d != "." {
+					domains = appendUnique(domains, strings.TrimSuffix(d, "."))
+				}
+			}
+		}
+	}
+	return domains
+}
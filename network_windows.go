@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// 遍历已连接网卡的网关地址
+func getGateways() []string {
+	var gateways []string
+	for aa := getAdapterAddresses(); aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		for gw := aa.FirstGatewayAddress; gw != nil; gw = gw.Next {
+			gateways = appendUnique(gateways, gw.Address.IP().String())
+		}
+	}
+	return gateways
+}
+
+// 遍历已连接网卡的 DNS 服务器
+func getDNSServers() []string {
+	var servers []string
+	for aa := getAdapterAddresses(); aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp {
+			continue
+		}
+		for dns := aa.FirstDnsServerAddress; dns != nil; dns = dns.Next {
+			ip := dns.Address.IP()
+			if ip == nil || strings.HasPrefix(ip.String(), "fec0:") {
+				continue // 未配置 IPv6 DNS 时系统填充的 fec0:0:0:ffff::1 等站点本地地址
+			}
+			servers = appendUnique(servers, ip.String())
+		}
+	}
+	return servers
+}
+
+// 本机的 DNS 域：主 DNS 后缀和各已连接网卡的连接特定后缀
+func getDNSDomains() []string {
+	var domains []string
+	if k, err := registry.OpenKey(registry.LOCAL_MACHINE, `SYSTEM\CurrentControlSet\Services\Tcpip\Parameters`, registry.QUERY_VALUE); err == nil {
+		for _, name := range []string{"Domain", "DhcpDomain"} {
+			if d, _, err := k.GetStringValue(name); err == nil && d != "" {
+				domains = appendUnique(domains, d)
+			}
+		}
+		k.Close()
+	}
+	for aa := getAdapterAddresses(); aa != nil; aa = aa.Next {
+		if aa.OperStatus != windows.IfOperStatusUp || aa.DnsSuffix == nil {
+			continue
+		}
+		if d := windows.UTF16PtrToString(aa.DnsSuffix); d != "" {
+			domains = appendUnique(domains, d)
+		}
+	}
+	return domains
+}
+
+// 调用 GetAdaptersAddresses，缓冲区不足时按返回的大小重试
+func getAdapterAddresses() *windows.IpAdapterAddresses {
+	size := uint32(15 * 1024)
+	for range 3 {
+		buf := make([]byte, size)
+		aa := (*windows.IpAdapterAddresses)(unsafe.Pointer(&buf[0]))
+		err := windows.GetAdaptersAddresses(windows.AF_UNSPEC, windows.GAA_FLAG_INCLUDE_GATEWAYS, 0, aa, &size)
+		if err == nil {
+			return aa
+		}
+		if err != windows.ERROR_BUFFER_OVERFLOW {
+			return nil
+		}
+	}
+	return nil
+}
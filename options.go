@@ -0,0 +1,32 @@
+package main
+
+// 服务端启动参数
+type ServerOptions struct {
+	Port     int
+	Interval int // 客户端上报间隔（分钟），用于判断在线状态
+
+	TLS      bool   // 启用 HTTPS
+	CertFile string // 证书和私钥路径
+	KeyFile  string
+	GenCert  bool // 证书不存在时自动生成自签名证书
+	MTLS     bool // 上报时要求客户端证书，由内置 CA 签发
+
+	EnrollToken      string // 客户端注册令牌，设置后上报时要求客户端密钥
+	RequireSignature bool   // 拒绝未签名的上报
+	Discovery        bool   // 应答客户端的局域网发现广播
+}
+
+// 客户端启动参数
+type ClientOptions struct {
+	Port     int
+	ServerIP string
+	Servers  []string // 按优先级排列的服务端地址，优先于 ServerIP
+	Interval int
+
+	TLS    bool   // 使用 HTTPS 连接服务端
+	CAFile string // 信任的 CA 证书，为空时使用系统证书
+	Pin    string // 服务端证书 SHA-256 指纹，设置后只信任该证书
+	MTLS   bool   // 向服务端注册并使用客户端证书
+
+	EnrollToken string // 注册令牌，用于获取客户端密钥
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// 按名称字母顺序排序，为空时填充 unknown
+func sortPrograms(programs ProgramList) ProgramList {
+	if len(programs) == 0 {
+		return append(programs, Program{Name: "unknown"}) // 防止数据库非空字段错误
+	}
+	sort.SliceStable(programs, func(i, j int) bool {
+		a, b := strings.ToLower(programs[i].Name), strings.ToLower(programs[j].Name)
+		if a != b {
+			return a < b
+		}
+		return programs[i].Version < programs[j].Version
+	})
+	return programs
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dpkgStatusPath = "/var/lib/dpkg/status"
+	dpkgInfoDir    = "/var/lib/dpkg/info"
+	apkInstalledDB = "/lib/apk/db/installed"
+	pacmanLocalDB  = "/var/lib/pacman/local"
+	snapMountDir   = "/snap"
+)
+
+// 软件包列表，直接读取各包管理器的数据库文件，不调用外部命令
+func getPrograms() ProgramList {
+	var programs ProgramList
+	programs = append(programs, getDpkgPackages()...)
+	programs = append(programs, getRpmPackages()...)
+	programs = append(programs, getApkPackages()...)
+	programs = append(programs, getPacmanPackages()...)
+	programs = append(programs, getFlatpakApps()...)
+	programs = append(programs, getSnapPackages()...)
+	return sortPrograms(programs)
+}
+
+// 文件修改时间作为安装日期
+func fileModDate(path string) string {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	return fi.ModTime().Format(time.DateOnly)
+}
+
+// 按空行分段解析 "Key: Value" 格式的数据库文件（dpkg status）
+// 以空格开头的续行属于上一字段，这里不需要，直接忽略
+func parseStanzaFile(path string) []map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var stanzas []map[string]string
+	cur := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(cur) > 0 {
+				stanzas = append(stanzas, cur)
+				cur = map[string]string{}
+			}
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		cur[key] = strings.TrimSpace(value)
+	}
+	if len(cur) > 0 {
+		stanzas = append(stanzas, cur)
+	}
+	return stanzas
+}
+
+// Debian / Ubuntu
+// dpkg 不记录安装时间，以 info 目录下文件列表的修改时间代替
+func getDpkgPackages() ProgramList {
+	var programs ProgramList
+	for _, s := range parseStanzaFile(dpkgStatusPath) {
+		if !strings.HasSuffix(s["Status"], " installed") {
+			continue // 已卸载但保留配置文件等状态
+		}
+		name := s["Package"]
+		if name == "" {
+			continue
+		}
+		arch := s["Architecture"]
+		installDate := fileModDate(filepath.Join(dpkgInfoDir, name+".list"))
+		if installDate == "" {
+			installDate = fileModDate(filepath.Join(dpkgInfoDir, name+":"+arch+".list")) // Multi-Arch
+		}
+		programs = append(programs, Program{
+			Name:         name,
+			Version:      s["Version"],
+			Publisher:    s["Maintainer"],
+			InstallDate:  installDate,
+			Architecture: arch,
+			Source:       "dpkg",
+		})
+	}
+	return programs
+}
+
+// Alpine，按空行分段，每行为单字母字段，如 P: 包名，V: 版本
+func getApkPackages() ProgramList {
+	f, err := os.Open(apkInstalledDB)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var programs ProgramList
+	var cur Program
+	flush := func() {
+		if cur.Name != "" {
+			cur.Source = "apk"
+			programs = append(programs, cur)
+		}
+		cur = Program{}
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "P":
+			cur.Name = value
+		case "V":
+			cur.Version = value
+		case "A":
+			cur.Architecture = value
+		case "m":
+			cur.Publisher = value
+		}
+	}
+	flush()
+	return programs
+}
+
+// Arch Linux，每个包一个目录，desc 文件中 %NAME% 等字段名的下一行为字段值
+func getPacmanPackages() ProgramList {
+	descs, _ := filepath.Glob(filepath.Join(pacmanLocalDB, "*", "desc"))
+	var programs ProgramList
+	for _, desc := range descs {
+		fields := readPacmanDesc(desc)
+		if fields["%NAME%"] == "" {
+			continue
+		}
+		var installDate string
+		if ts, err := strconv.ParseInt(fields["%INSTALLDATE%"], 10, 64); err == nil {
+			installDate = time.Unix(ts, 0).Format(time.DateOnly)
+		}
+		programs = append(programs, Program{
+			Name:         fields["%NAME%"],
+			Version:      fields["%VERSION%"],
+			Publisher:    fields["%PACKAGER%"],
+			InstallDate:  installDate,
+			Architecture: fields["%ARCH%"],
+			Source:       "pacman",
+		})
+	}
+	return programs
+}
+
+func readPacmanDesc(path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key := scanner.Text()
+		if strings.HasPrefix(key, "%") && strings.HasSuffix(key, "%") && scanner.Scan() {
+			fields[key] = strings.TrimSpace(scanner.Text())
+		}
+	}
+	return fields
+}
+
+// Flatpak，系统级和各用户目录下的应用 ID
+// 目录结构为 app/<应用 ID>/<架构>/<分支>
+func getFlatpakApps() ProgramList {
+	dirs := []string{"/var/lib/flatpak/app"}
+	homes, _ := filepath.Glob("/home/*")
+	homes = append(homes, "/root")
+	for _, home := range homes {
+		dirs = append(dirs, filepath.Join(home, ".local/share/flatpak/app"))
+	}
+
+	var programs ProgramList
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				continue
+			}
+			location := filepath.Join(dir, e.Name())
+			p := Program{
+				Name:            e.Name(),
+				InstallDate:     fileModDate(location),
+				InstallLocation: location,
+				Source:          "flatpak",
+			}
+			if arches, err := os.ReadDir(location); err == nil {
+				for _, a := range arches {
+					if a.IsDir() {
+						p.Architecture = a.Name()
+						break
+					}
+				}
+			}
+			programs = append(programs, p)
+		}
+	}
+	return programs
+}
+
+// Snap，已安装的包在 /snap/<name>/current 下挂载，版本号等信息在 meta/snap.yaml 中
+func getSnapPackages() ProgramList {
+	entries, err := os.ReadDir(snapMountDir)
+	if err != nil {
+		return nil
+	}
+	var programs ProgramList
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == "bin" {
+			continue
+		}
+		current := filepath.Join(snapMountDir, e.Name(), "current")
+		if _, err := os.Lstat(current); err != nil {
+			continue
+		}
+		meta := readSnapMeta(filepath.Join(current, "meta", "snap.yaml"))
+		programs = append(programs, Program{
+			Name:            e.Name(),
+			Version:         meta["version"],
+			InstallDate:     fileModDate(current),
+			InstallLocation: filepath.Join(snapMountDir, e.Name()),
+			Architecture:    meta["architectures"],
+			Source:          "snap",
+		})
+	}
+	return programs
+}
+
+// 只读取 snap.yaml 中的顶层标量字段，列表字段（如 architectures）取第一项
+func readSnapMeta(path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	meta := map[string]string{}
+	var listKey string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if listKey != "" {
+			if item, ok := strings.CutPrefix(strings.TrimSpace(line), "- "); ok {
+				if meta[listKey] == "" {
+					meta[listKey] = strings.Trim(item, `"' `)
+				}
+				continue
+			}
+			listKey = ""
+		}
+		if line == "" || line[0] == ' ' || line[0] == '#' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"'`)
+		if list, ok := strings.CutPrefix(value, "["); ok { // 行内列表 [amd64, arm64]
+			value, _, _ = strings.Cut(strings.TrimSuffix(list, "]"), ",")
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+		if value == "" {
+			listKey = key
+			continue
+		}
+		meta[key] = value
+	}
+	return meta
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"os"
+	"time"
+)
+
+// rpm 4.16 起默认使用 sqlite 格式的数据库，不同发行版存放位置不同
+// 旧版 Berkeley DB 格式（Packages 文件）不支持
+var rpmDBPaths = []string{
+	"/var/lib/rpm/rpmdb.sqlite",
+	"/usr/lib/sysimage/rpm/rpmdb.sqlite",
+}
+
+// rpm 头部中用到的标签和数据类型
+const (
+	rpmTagName        = 1000
+	rpmTagVersion     = 1001
+	rpmTagRelease     = 1002
+	rpmTagInstallTime = 1008
+	rpmTagVendor      = 1011
+	rpmTagArch        = 1022
+
+	rpmTypeInt32       = 4
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+// RedHat / Fedora / openSUSE
+func getRpmPackages() ProgramList {
+	for _, path := range rpmDBPaths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		// immutable 避免只读打开时仍需创建 -shm 等文件
+		rpmdb, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&immutable=1")
+		if err != nil {
+			continue
+		}
+		programs := readRpmPackages(rpmdb)
+		rpmdb.Close()
+		return programs
+	}
+	return nil
+}
+
+func readRpmPackages(rpmdb *sql.DB) ProgramList {
+	rows, err := rpmdb.Query("SELECT blob FROM Packages")
+	if err != nil {
+		return nil
+	}
+	defer rows.Close()
+
+	var programs ProgramList
+	for rows.Next() {
+		var blob []byte
+		if err := rows.Scan(&blob); err != nil {
+			continue
+		}
+		h := parseRpmHeader(blob)
+		if h == nil || h.str(rpmTagName) == "" {
+			continue
+		}
+		if h.str(rpmTagName) == "gpg-pubkey" {
+			continue // 导入的签名公钥，不是软件
+		}
+		version := h.str(rpmTagVersion)
+		if release := h.str(rpmTagRelease); release != "" {
+			version += "-" + release
+		}
+		var installDate string
+		if ts := h.int32(rpmTagInstallTime); ts > 0 {
+			installDate = time.Unix(int64(ts), 0).Format(time.DateOnly)
+		}
+		programs = append(programs, Program{
+			Name:         h.str(rpmTagName),
+			Version:      version,
+			Publisher:    h.str(rpmTagVendor),
+			InstallDate:  installDate,
+			Architecture: h.str(rpmTagArch),
+			Source:       "rpm",
+		})
+	}
+	return programs
+}
+
+type rpmHeaderEntry struct {
+	typ    uint32
+	offset uint32
+	count  uint32
+}
+
+type rpmHeader struct {
+	entries map[uint32]rpmHeaderEntry
+	data    []byte
+}
+
+// 头部结构：索引条数、数据区长度（均为大端 int32），每条索引 16 字节（标签、类型、偏移、数量），之后为数据区
+func parseRpmHeader(blob []byte) *rpmHeader {
+	if len(blob) < 8 {
+		return nil
+	}
+	il := binary.BigEndian.Uint32(blob[0:4])
+	dl := binary.BigEndian.Uint32(blob[4:8])
+	dataStart := 8 + uint64(il)*16
+	if dataStart+uint64(dl) > uint64(len(blob)) {
+		return nil
+	}
+	h := &rpmHeader{
+		entries: make(map[uint32]rpmHeaderEntry, il),
+		data:    blob[dataStart : dataStart+uint64(dl)],
+	}
+	for i := range uint64(il) {
+		e := blob[8+i*16 : 8+i*16+16]
+		h.entries[binary.BigEndian.Uint32(e[0:4])] = rpmHeaderEntry{
+			typ:    binary.BigEndian.Uint32(e[4:8]),
+			offset: binary.BigEndian.Uint32(e[8:12]),
+			count:  binary.BigEndian.Uint32(e[12:16]),
+		}
+	}
+	return h
+}
+
+// 字符串类型取第一个以 0 结尾的字符串
+func (h *rpmHeader) str(tag uint32) string {
+	e, ok := h.entries[tag]
+	if !ok || int(e.offset) >= len(h.data) {
+		return ""
+	}
+	switch e.typ {
+	case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+	default:
+		return ""
+	}
+	b := h.data[e.offset:]
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func (h *rpmHeader) int32(tag uint32) uint32 {
+	e, ok := h.entries[tag]
+	if !ok || e.typ != rpmTypeInt32 || int(e.offset)+4 > len(h.data) {
+		return 0
+	}
+	return binary.BigEndian.Uint32(h.data[e.offset:])
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	initialDelayMax = 5 * time.Minute // 启动后随机延迟的上限，避免同时开机的机器同时上报
+	intervalJitter  = 0.1             // 上报间隔随机浮动 ±10%
+	backoffJitter   = 0.2
+	backoffBase     = 30 * time.Second // 首次失败后的重试间隔，之后每次翻倍
+	backoffMax      = time.Hour        // 连续失败时重试间隔的上限
+	retryAfterMax   = time.Hour        // 服务端 Retry-After 的上限，避免错误的响应头使客户端长时间停止上报
+)
+
+// 客户端上报调度：随机化的启动延迟和上报间隔，失败时指数退避，并遵守服务端的 Retry-After
+type reportScheduler struct {
+	interval time.Duration
+	failures int // 连续失败次数
+}
+
+func newReportScheduler(interval int) *reportScheduler {
+	return &reportScheduler{interval: time.Duration(interval) * time.Minute}
+}
+
+func (s *reportScheduler) initialDelay() time.Duration {
+	limit := min(s.interval, initialDelayMax)
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
+
+// 根据本次上报结果计算下次上报前的等待时间
+func (s *reportScheduler) next(err error) time.Duration {
+	if err == nil {
+		s.failures = 0
+		return jitter(s.interval, intervalJitter)
+	}
+	s.failures++
+	delay := backoffBase
+	for i := 1; i < s.failures && delay < backoffMax; i++ {
+		delay *= 2
+	}
+	delay = jitter(min(delay, backoffMax), backoffJitter)
+
+	var statusErr *reportStatusError
+	if errors.As(err, &statusErr) && statusErr.retryAfter > delay {
+		delay = statusErr.retryAfter
+	}
+	return delay
+}
+
+// 在 d 的基础上随机浮动 ±fraction
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if d <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) * (1 + fraction*(2*rand.Float64()-1)))
+}
+
+// 解析 Retry-After，支持秒数和 HTTP 日期两种格式，最长为 retryAfterMax
+func parseRetryAfter(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs > 0 {
+		return time.Duration(min(secs, int(retryAfterMax/time.Second))) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return min(max(time.Until(t), 0), retryAfterMax)
+	}
+	return 0
+}
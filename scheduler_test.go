@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// d 是否在 base 随机浮动 ±fraction 的范围内
+func withinJitter(d, base time.Duration, fraction float64) bool {
+	return float64(d) >= float64(base)*(1-fraction) && float64(d) <= float64(base)*(1+fraction)
+}
+
+func TestSchedulerNext(t *testing.T) {
+	s := newReportScheduler(10)
+	errFailed := errors.New("connection refused")
+
+	tests := []struct {
+		name     string
+		err      error
+		want     time.Duration
+		fraction float64
+	}{
+		{"成功", nil, 10 * time.Minute, intervalJitter},
+		{"第 1 次失败", errFailed, backoffBase, backoffJitter},
+		{"第 2 次失败", errFailed, 2 * backoffBase, backoffJitter},
+		{"第 3 次失败", errFailed, 4 * backoffBase, backoffJitter},
+		{"Retry-After 更长", &reportStatusError{code: http.StatusServiceUnavailable, retryAfter: 30 * time.Minute}, 30 * time.Minute, 0},
+		{"Retry-After 更短", &reportStatusError{code: http.StatusServiceUnavailable, retryAfter: time.Second}, 16 * backoffBase, backoffJitter},
+		{"成功后重置", nil, 10 * time.Minute, intervalJitter},
+		{"重置后第 1 次失败", errFailed, backoffBase, backoffJitter},
+	}
+	for _, tt := range tests {
+		if got := s.next(tt.err); !withinJitter(got, tt.want, tt.fraction) {
+			t.Errorf("%s: got %v, want %v ±%v", tt.name, got, tt.want, tt.fraction)
+		}
+	}
+}
+
+func TestSchedulerBackoffMax(t *testing.T) {
+	s := newReportScheduler(10)
+	var got time.Duration
+	for range 20 {
+		got = s.next(errors.New("timeout"))
+	}
+	if !withinJitter(got, backoffMax, backoffJitter) {
+		t.Errorf("got %v, want %v ±%v", got, backoffMax, backoffJitter)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 60 ", time.Minute},
+		{"0", 0},
+		{"-5", 0},
+		{"abc", 0},
+		{"86400", retryAfterMax},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+		{time.Now().Add(48 * time.Hour).UTC().Format(http.TimeFormat), retryAfterMax},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	// HTTP 日期精确到秒，结果略小于设定的时长
+	value := time.Now().Add(10 * time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(value); got <= 9*time.Minute || got > 10*time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, want about 10m", value, got)
+	}
+}
@@ -1,30 +1,190 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-func startServer(port, interval int) {
+// 单次上报的大小上限，软件列表较长时也远小于此
+const maxReportSize = 32 << 20
+
+// 保存失败时建议客户端重试的等待时间
+const saveRetryAfter = time.Minute
+
+// 服务端连接超时，读写超时按慢速网络下上报和导出的最大数据量估计
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 2 * time.Minute
+	writeTimeout      = 2 * time.Minute
+	idleTimeout       = 2 * time.Minute
+	shutdownTimeout   = 30 * time.Second // 等待处理中的上报完成的最长时间
+	readinessDrain    = 5 * time.Second  // 退出前 /readyz 先返回 503 的时间，供负载均衡摘除节点
+)
+
+// 运行中的服务，退出时由 stopCollectService 按顺序关闭
+// 托盘模式下启动和退出在不同的 goroutine 中，由 serviceMu 保护
+var (
+	serviceMu     sync.Mutex
+	collectServer *http.Server
+	discoveryConn net.PacketConn
+	shuttingDown  atomic.Bool
+)
+
+func startServer(opts ServerOptions) {
+	startCollectService(opts)
+	go startServerGUI(opts.Interval)
+}
+
+// 启动数据库和数据收集服务，不依赖图形界面
+func startCollectService(opts ServerOptions) {
 	log.Println("【Server】", "启动中 ...")
 	err := initDataBase()
 	if err != nil {
 		log.Fatalln("【Server】", err)
 	}
 	http.HandleFunc("/report", handleReport)
+	http.HandleFunc("/enroll", handleEnroll)
+	http.HandleFunc("/tasks", handleTaskPoll)
+	http.HandleFunc("/tasks/ack", handleTaskAck)
+	if err := ensureAdminUser(); err != nil {
+		log.Fatalln("【Server】", err)
+	}
+	registerAPI(http.DefaultServeMux)
+	registerWeb(http.DefaultServeMux)
+	// Prometheus 使用 API 令牌抓取
+	http.HandleFunc("GET /metrics", authorize(roleViewer, handleMetrics))
+	http.HandleFunc("GET /healthz", handleLiveness)
+	http.HandleFunc("GET /readyz", handleReadiness)
 
-	addr := fmt.Sprintf(":%d", port)
-	log.Println("【Server】", "服务监听端口:", addr[1:])
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", opts.Port),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+	onlineInterval = time.Duration(opts.Interval) * time.Minute
+	enrollToken = opts.EnrollToken
+	requireSignature = opts.RequireSignature
+	if opts.MTLS {
+		agentCA, err = loadCertAuthority()
+		if err != nil {
+			log.Fatalln("【Server】", err)
+		}
+	}
+	if opts.TLS {
+		server.TLSConfig, err = loadServerTLSConfig(opts)
+		if err != nil {
+			log.Fatalln("【Server】", err)
+		}
+	}
+	// 先监听端口，端口被占用等错误在启动时即可发现
+	ln, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatalln("【Server】", "服务启动失败:", err)
+	}
+	log.Println("【Server】", "服务监听端口:", opts.Port, "TLS:", opts.TLS)
+	serviceMu.Lock()
+	defer serviceMu.Unlock()
+	if shuttingDown.Load() {
+		// 启动过程中已收到退出信号
+		ln.Close()
+		return
+	}
+	if opts.Discovery {
+		discoveryConn = startDiscoveryResponder(opts)
+	}
+	collectServer = server
 	// 并发启动
 	go func() {
-		if err := http.ListenAndServe(addr, nil); err != nil {
-			log.Fatalln("【Server】", "服务启动失败:", err)
+		var err error
+		if opts.TLS {
+			err = server.ServeTLS(ln, "", "") // 证书已在 TLSConfig 中
+		} else {
+			err = server.Serve(ln)
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalln("【Server】", "服务异常退出:", err)
 		}
 	}()
-	go startServerGUI(interval)
+}
 
+// 先让 /readyz 返回 503 一段时间，再停止接收新请求，等待处理中的上报完成后关闭数据库
+// 超时仍未完成的连接直接断开
+func stopCollectService() {
+	serviceMu.Lock()
+	shuttingDown.Store(true)
+	server, conn := collectServer, discoveryConn
+	collectServer, discoveryConn = nil, nil
+	serviceMu.Unlock()
+
+	if conn != nil {
+		conn.Close()
+	}
+	if server != nil {
+		log.Println("【Server】", "就绪检查已返回 503，等待负载均衡摘除 ...")
+		time.Sleep(readinessDrain)
+		log.Println("【Server】", "停止接收请求，等待处理中的请求完成 ...")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("【Server】", "等待请求完成超时，强制断开:", err)
+			server.Close()
+		}
+	}
+	closeDataBase()
+	log.Println("【Server】", "数据库已关闭")
+}
+
+// 存活检查：进程能响应即可
+func handleLiveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
+
+// 就绪检查：正在退出或数据库不可用时返回 503，负载均衡据此摘除
+func handleReadiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if shuttingDown.Load() {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if err := pingDataBase(r.Context()); err != nil {
+		log.Println("【Server】", "就绪检查失败:", err)
+		http.Error(w, "database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+}
+
+// 校验客户端请求：启用 mTLS 或令牌注册时拒绝未认证的请求，并校验签名
+// 失败时写入响应并返回 false
+func checkAgentRequest(w http.ResponseWriter, r *http.Request, body []byte, data *ClientInfo) bool {
+	if status, err := authenticateReport(r, data); err != nil {
+		log.Printf("【Server】 拒绝来自 %v 的请求 %v: %v\n", r.RemoteAddr, r.URL.Path, err)
+		http.Error(w, "客户端认证失败", status)
+		return false
+	}
+	if err := verifyReportSignature(r, body, data.AgentID); err != nil {
+		log.Printf("【Server】 签名校验失败，拒绝来自 %v（agent %v）的请求 %v: %v\n", r.RemoteAddr, data.AgentID, r.URL.Path, err)
+		http.Error(w, "签名校验失败", http.StatusForbidden)
+		return false
+	}
+	return true
 }
 
 // 对接收到的数据处理
@@ -33,21 +193,49 @@ func handleReport(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "只支持 POST 请求", http.StatusMethodNotAllowed)
 		return
 	}
+	start, result := time.Now(), reportInvalid
+	defer func() { observeReport(result, start) }()
+	// 签名针对原始请求体，需先完整读取
+	body, err := readBody(w, r, maxReportSize)
+	if err != nil {
+		log.Println("【Server】", "读取数据失败:", err)
+		http.Error(w, "读取数据失败", http.StatusBadRequest)
+		return
+	}
 	var data ClientInfo
-	err := json.NewDecoder(r.Body).Decode(&data)
+	err = json.Unmarshal(body, &data)
 	if err != nil {
 		log.Println("【Server】", "JSON 解析错误:", err)
+		countDecodeError()
 		http.Error(w, "无效 JSON", http.StatusBadRequest)
 		return
 	}
-	// 保存到数据库
-	err = saveToDB(data)
+	if !checkAgentRequest(w, r, body, &data) {
+		result = reportRejected
+		return
+	}
+	data.normalize()
+	data.clampUpdated(time.Now())
+	if data.Endpoint == "" {
+		data.Endpoint = r.Host // 旧版客户端不上报，以请求的地址代替
+	}
+	// 识别主机身份并保存到数据库
+	// 保存失败时返回 503，客户端保留离线缓存稍后重试，否则数据会丢失
+	err = saveToDB(&data)
 	if err != nil {
 		log.Println("【Server】", "保存数据失败:", err)
-	} else {
-		log.Printf("【Server】 收到一条来自 %v 的数据\n", data.Hostname)
+		result = reportDBError
+		w.Header().Set("Retry-After", strconv.Itoa(int(saveRetryAfter.Seconds())))
+		http.Error(w, "保存数据失败，请稍后重试", http.StatusServiceUnavailable)
+		return
+	}
+	result = reportOK
+	log.Printf("【Server】 收到一条来自 %v 的数据\n", data.Hostname)
+	// 响应中下发该主机的配置
+	cfg, err := loadAgentConfig(data.HostID)
+	if err != nil {
+		log.Println("【Server】", "读取客户端配置失败:", err)
 	}
-	// 即使数据库保存失败也要正确返回
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cfg)
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	serversFile = "servers" // 未通过参数指定服务端列表时从此文件读取，每行一个地址
+
+	endpointRetryMin = 30 * time.Second // 服务端不可用后再次尝试的等待时间，连续失败时翻倍
+	endpointRetryMax = 30 * time.Minute
+)
+
+// 服务端地址及其可用状态
+type serverEndpoint struct {
+	url       string
+	failures  int       // 连续失败次数
+	downUntil time.Time // 在此之前不再尝试，除非所有服务端都不可用
+}
+
+// 按优先级排列的服务端列表，持续使用可用的服务端，不可用时依次切换
+// 优先级更高的服务端恢复后自动切回
+type serverPool struct {
+	endpoints []*serverEndpoint
+	current   int
+}
+
+func newServerPool(urls []string) *serverPool {
+	p := &serverPool{}
+	for _, u := range urls {
+		p.endpoints = append(p.endpoints, &serverEndpoint{url: u})
+	}
+	return p
+}
+
+func (p *serverPool) empty() bool {
+	return len(p.endpoints) == 0
+}
+
+// 当前使用的服务端
+func (p *serverPool) active() string {
+	if p.empty() {
+		return ""
+	}
+	return p.endpoints[p.current].url
+}
+
+// 本次上报依次尝试的服务端：按优先级排列的可用服务端在前，其中已到重试时间的高优先级服务端
+// 排在当前服务端之前，恢复后即切回；不可用的服务端排在最后，都连接失败时仍全部尝试
+func (p *serverPool) candidates() []*serverEndpoint {
+	now := time.Now()
+	var up, down []*serverEndpoint
+	for _, e := range p.endpoints {
+		if now.Before(e.downUntil) {
+			down = append(down, e)
+		} else {
+			up = append(up, e)
+		}
+	}
+	return append(up, down...)
+}
+
+// 服务端列表是否与 urls 相同，相同时保留各服务端的状态
+func (p *serverPool) equal(urls []string) bool {
+	if len(p.endpoints) != len(urls) {
+		return false
+	}
+	for i, e := range p.endpoints {
+		if e.url != urls[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *serverPool) success(e *serverEndpoint) {
+	e.failures, e.downUntil = 0, time.Time{}
+	for i, x := range p.endpoints {
+		if x == e && i != p.current {
+			log.Printf("【Client】 切换服务端: %v -> %v\n", p.endpoints[p.current].url, e.url)
+			p.current = i
+		}
+	}
+}
+
+func (p *serverPool) failure(e *serverEndpoint) {
+	e.failures++
+	retry := endpointRetryMin
+	for i := 1; i < e.failures && retry < endpointRetryMax; i++ {
+		retry *= 2
+	}
+	e.downUntil = time.Now().Add(min(retry, endpointRetryMax))
+}
+
+// 连接失败或服务端内部错误时尝试下一个服务端，认证失败等其他错误换服务端也无济于事
+func shouldFailover(err error) bool {
+	var statusErr *reportStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code >= http.StatusInternalServerError || statusErr.code == http.StatusNotFound
+	}
+	return errors.Is(err, errServerUnreachable)
+}
+
+// 解析逗号或换行分隔的服务端列表
+func parseServerList(s string) []string {
+	var list []string
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			list = append(list, line)
+		}
+	}
+	return list
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 上报签名相关的请求头
+const (
+	headerReportTimestamp = "X-Report-Timestamp"
+	headerReportNonce     = "X-Report-Nonce"
+	headerReportPublicKey = "X-Report-Public-Key"
+	headerReportSignature = "X-Report-Signature"
+	headerReportSignVer   = "X-Report-Sign-Version"
+
+	reportSignVersion = "2" // 签名包含请求方法、路径和查询参数
+
+	reportMaxSkew = 5 * time.Minute // 时间戳允许的偏差，超出视为过期
+	signKeyFile   = "sign.key"
+)
+
+// 为 true 时拒绝未签名的上报，否则只校验已签名的上报和已登记公钥的客户端
+var requireSignature bool
+
+// 签名内容：请求方法、路径和查询参数、时间戳、nonce 和完整的请求体
+// 旧版客户端不发送签名版本，只签名时间戳、nonce 和请求体
+func reportSignedMessage(version, method, uri, timestamp, nonce string, body []byte) []byte {
+	var msg []byte
+	if version == reportSignVersion {
+		msg = append(msg, method+" "+uri+"\n"...)
+	}
+	msg = append(msg, timestamp...)
+	msg = append(msg, '\n')
+	msg = append(msg, nonce...)
+	msg = append(msg, '\n')
+	return append(msg, body...)
+}
+
+// 客户端签名私钥，首次运行时生成
+func loadSignKey() (ed25519.PrivateKey, error) {
+	if seed, err := base64.StdEncoding.DecodeString(readStateFile(signKeyFile)); err == nil && len(seed) == ed25519.SeedSize {
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeStateFile(signKeyFile, []byte(base64.StdEncoding.EncodeToString(key.Seed()))); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// 为上报请求签名
+func signReport(req *http.Request, key ed25519.PrivateKey, body []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	n := hex.EncodeToString(nonce)
+	sig := ed25519.Sign(key, reportSignedMessage(reportSignVersion, req.Method, req.URL.RequestURI(), ts, n, body))
+	req.Header.Set(headerReportSignVer, reportSignVersion)
+	req.Header.Set(headerReportTimestamp, ts)
+	req.Header.Set(headerReportNonce, n)
+	req.Header.Set(headerReportPublicKey, base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	req.Header.Set(headerReportSignature, base64.StdEncoding.EncodeToString(sig))
+	return nil
+}
+
+// 校验上报签名
+// 客户端首次上报签名时登记公钥（TOFU），之后只接受该公钥的签名；时间戳过期或 nonce 重复视为重放
+func verifyReportSignature(r *http.Request, body []byte, agentID string) error {
+	sigHeader := r.Header.Get(headerReportSignature)
+	if sigHeader == "" {
+		if requireSignature {
+			return fmt.Errorf("缺少签名")
+		}
+		var pinned bool
+		if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM agent_sign_key WHERE agent_id = ?)", agentID).Scan(&pinned); err != nil {
+			return err
+		}
+		if pinned {
+			return fmt.Errorf("agent %v 已登记公钥，但上报未签名", agentID)
+		}
+		return nil // 旧版客户端
+	}
+	if agentID == "" {
+		return fmt.Errorf("签名的上报缺少 agent ID")
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(r.Header.Get(headerReportPublicKey))
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("公钥格式错误")
+	}
+	sig, err := base64.StdEncoding.DecodeString(sigHeader)
+	if err != nil {
+		return fmt.Errorf("签名格式错误")
+	}
+	ts := r.Header.Get(headerReportTimestamp)
+	nonce := r.Header.Get(headerReportNonce)
+	if nonce == "" || len(nonce) > 64 {
+		return fmt.Errorf("nonce 格式错误")
+	}
+	// 旧版签名不包含查询参数，不能用于通过查询参数指定主机的任务接口
+	version := r.Header.Get(headerReportSignVer)
+	if version != reportSignVersion && r.URL.RawQuery != "" {
+		return fmt.Errorf("签名版本过旧，未包含请求参数")
+	}
+	if !ed25519.Verify(pub, reportSignedMessage(version, r.Method, r.URL.RequestURI(), ts, nonce, body), sig) {
+		return fmt.Errorf("签名无效")
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("时间戳格式错误")
+	}
+	if skew := time.Since(time.Unix(unix, 0)); skew > reportMaxSkew || skew < -reportMaxSkew {
+		return fmt.Errorf("时间戳过期: %v", time.Unix(unix, 0).Format(time.RFC3339))
+	}
+
+	pubText := base64.StdEncoding.EncodeToString(pub)
+	var pinned string
+	err = db.QueryRow("SELECT public_key FROM agent_sign_key WHERE agent_id = ?", agentID).Scan(&pinned)
+	switch {
+	case err == sql.ErrNoRows:
+		_, err = db.Exec("INSERT INTO agent_sign_key (agent_id, public_key, first_seen) VALUES (?,?,?)",
+			agentID, pubText, time.Now().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case pinned != pubText:
+		return fmt.Errorf("公钥与 agent %v 登记的公钥不一致", agentID)
+	}
+
+	// nonce 只需保留时间戳有效期内的记录
+	now := time.Now()
+	if _, err := db.Exec("DELETE FROM report_nonce WHERE time < ?", now.Add(-2*reportMaxSkew).Unix()); err != nil {
+		return err
+	}
+	res, err := db.Exec("INSERT OR IGNORE INTO report_nonce (nonce, agent_id, time) VALUES (?,?,?)", nonce, agentID, now.Unix())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("nonce 重复: %v", nonce)
+	}
+	return nil
+}
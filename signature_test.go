@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 在临时目录中创建数据库，测试结束后关闭
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	if err := initDataBase(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(closeDataBase)
+}
+
+func newTestSignKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// 按指定签名版本和时间戳构造已签名的请求，version 为空时与旧版客户端一致
+func newSignedRequest(key ed25519.PrivateKey, version, method, target string, ts time.Time, nonce string, body []byte) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewReader(body))
+	unix := strconv.FormatInt(ts.Unix(), 10)
+	sig := ed25519.Sign(key, reportSignedMessage(version, method, req.URL.RequestURI(), unix, nonce, body))
+	if version != "" {
+		req.Header.Set(headerReportSignVer, version)
+	}
+	req.Header.Set(headerReportTimestamp, unix)
+	req.Header.Set(headerReportNonce, nonce)
+	req.Header.Set(headerReportPublicKey, base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)))
+	req.Header.Set(headerReportSignature, base64.StdEncoding.EncodeToString(sig))
+	return req
+}
+
+func TestReportSignedMessage(t *testing.T) {
+	body := []byte(`{"host_id":"a"}`)
+	tests := []struct {
+		name    string
+		version string
+		want    string
+	}{
+		{"v1", "", "1700000000\nabc\n" + `{"host_id":"a"}`},
+		{"v2", reportSignVersion, "GET /tasks?host_id=a\n1700000000\nabc\n" + `{"host_id":"a"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := reportSignedMessage(tt.version, http.MethodGet, "/tasks?host_id=a", "1700000000", "abc", body)
+			if string(got) != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyReportSignature(t *testing.T) {
+	setupTestDB(t)
+	requireSignature = false
+	key := newTestSignKey(t)
+	body := []byte(`{"host_id":"a"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		agentID string
+		req     func() *http.Request
+		wantErr string
+	}{
+		{
+			name:    "v2 上报",
+			agentID: "agent-v2",
+			req: func() *http.Request {
+				return newSignedRequest(key, reportSignVersion, http.MethodPost, "/report", now, "n-v2", body)
+			},
+		},
+		{
+			name:    "v2 带查询参数",
+			agentID: "agent-v2-query",
+			req: func() *http.Request {
+				return newSignedRequest(key, reportSignVersion, http.MethodGet, "/tasks?host_id=a&agent_id=agent-v2-query", now, "n-v2-query", body)
+			},
+		},
+		{
+			name:    "v1 上报",
+			agentID: "agent-v1",
+			req: func() *http.Request {
+				return newSignedRequest(key, "", http.MethodPost, "/report", now, "n-v1", body)
+			},
+		},
+		{
+			name:    "v1 带查询参数",
+			agentID: "agent-v1-query",
+			req: func() *http.Request {
+				return newSignedRequest(key, "", http.MethodGet, "/tasks?host_id=a", now, "n-v1-query", body)
+			},
+			wantErr: "签名版本过旧",
+		},
+		{
+			name:    "修改请求方法",
+			agentID: "agent-method",
+			req: func() *http.Request {
+				req := newSignedRequest(key, reportSignVersion, http.MethodPost, "/report", now, "n-method", body)
+				req.Method = http.MethodPut
+				return req
+			},
+			wantErr: "签名无效",
+		},
+		{
+			name:    "修改查询参数",
+			agentID: "agent-path",
+			req: func() *http.Request {
+				req := newSignedRequest(key, reportSignVersion, http.MethodGet, "/tasks?host_id=a", now, "n-path", body)
+				req.URL.RawQuery = "host_id=b"
+				return req
+			},
+			wantErr: "签名无效",
+		},
+		{
+			name:    "修改请求体",
+			agentID: "agent-body",
+			req: func() *http.Request {
+				return newSignedRequest(key, reportSignVersion, http.MethodPost, "/report", now, "n-body", []byte(`{"host_id":"b"}`))
+			},
+			wantErr: "签名无效",
+		},
+		{
+			name:    "时间戳过期",
+			agentID: "agent-stale",
+			req: func() *http.Request {
+				return newSignedRequest(key, reportSignVersion, http.MethodPost, "/report", now.Add(-reportMaxSkew-time.Minute), "n-stale", body)
+			},
+			wantErr: "时间戳过期",
+		},
+		{
+			name:    "时间戳超前",
+			agentID: "agent-future",
+			req: func() *http.Request {
+				return newSignedRequest(key, reportSignVersion, http.MethodPost, "/report", now.Add(reportMaxSkew+time.Minute), "n-future", body)
+			},
+			wantErr: "时间戳过期",
+		},
+		{
+			name:    "缺少 agent ID",
+			agentID: "",
+			req: func() *http.Request {
+				return newSignedRequest(key, reportSignVersion, http.MethodPost, "/report", now, "n-no-agent", body)
+			},
+			wantErr: "缺少 agent ID",
+		},
+		{
+			name:    "未登记公钥的未签名上报",
+			agentID: "agent-legacy",
+			req: func() *http.Request {
+				return httptest.NewRequest(http.MethodPost, "/report", bytes.NewReader(body))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyReportSignature(tt.req(), body, tt.agentID)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyReportSignatureReplay(t *testing.T) {
+	setupTestDB(t)
+	requireSignature = false
+	key := newTestSignKey(t)
+	body := []byte(`{"host_id":"a"}`)
+
+	req := newSignedRequest(key, reportSignVersion, http.MethodPost, "/report", time.Now(), "n-replay", body)
+	if err := verifyReportSignature(req, body, "agent-replay"); err != nil {
+		t.Fatalf("first report: %v", err)
+	}
+	req = newSignedRequest(key, reportSignVersion, http.MethodPost, "/report", time.Now(), "n-replay", body)
+	if err := verifyReportSignature(req, body, "agent-replay"); err == nil || !strings.Contains(err.Error(), "nonce 重复") {
+		t.Fatalf("got error %v, want nonce 重复", err)
+	}
+}
+
+func TestVerifyReportSignaturePinned(t *testing.T) {
+	setupTestDB(t)
+	requireSignature = false
+	key := newTestSignKey(t)
+	body := []byte(`{"host_id":"a"}`)
+
+	// signReport 生成的签名用于首次上报并登记公钥
+	req := httptest.NewRequest(http.MethodPost, "/report", bytes.NewReader(body))
+	if err := signReport(req, key, body); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyReportSignature(req, body, "agent-pinned"); err != nil {
+		t.Fatalf("first report: %v", err)
+	}
+
+	unsigned := httptest.NewRequest(http.MethodPost, "/report", bytes.NewReader(body))
+	if err := verifyReportSignature(unsigned, body, "agent-pinned"); err == nil || !strings.Contains(err.Error(), "已登记公钥") {
+		t.Errorf("unsigned report: got error %v, want 已登记公钥", err)
+	}
+
+	other := newSignedRequest(newTestSignKey(t), reportSignVersion, http.MethodPost, "/report", time.Now(), "n-other", body)
+	if err := verifyReportSignature(other, body, "agent-pinned"); err == nil || !strings.Contains(err.Error(), "公钥与") {
+		t.Errorf("other key: got error %v, want 公钥不一致", err)
+	}
+}
+
+func TestVerifyReportSignatureRequired(t *testing.T) {
+	setupTestDB(t)
+	requireSignature = true
+	t.Cleanup(func() { requireSignature = false })
+
+	req := httptest.NewRequest(http.MethodPost, "/report", nil)
+	if err := verifyReportSignature(req, nil, "agent-new"); err == nil || !strings.Contains(err.Error(), "缺少签名") {
+		t.Fatalf("got error %v, want 缺少签名", err)
+	}
+}
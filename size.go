@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 字节数，JSON 和数据库中保存为整数，显示时格式化为 GB / TB
+type ByteSize uint64
+
+func (s ByteSize) String() string {
+	return formatBytes(uint64(s))
+}
+
+// 格式化容量，如 8.25 GB
+func formatBytes(n uint64) string {
+	if n >= (1 << 40) {
+		return fmt.Sprintf("%.2f TB", float64(n)/(1<<40))
+	}
+	return fmt.Sprintf("%.2f GB", float64(n)/(1<<30))
+}
+
+// 解析格式化后的容量字符串，用于兼容旧版客户端和旧数据
+func parseBytes(s string) ByteSize {
+	parts := strings.Fields(s) // "8.25 GB" -> ["8.25", "GB"]
+	if len(parts) != 2 {
+		return 0
+	}
+	val, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return 0
+	}
+	switch strings.ToUpper(parts[1]) {
+	case "TB":
+		val *= 1 << 40
+	case "GB":
+		val *= 1 << 30
+	case "MB":
+		val *= 1 << 20
+	case "KB":
+		val *= 1 << 10
+	}
+	return ByteSize(val)
+}
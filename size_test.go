@@ -0,0 +1,37 @@
+package main
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		value string
+		want  ByteSize
+	}{
+		{"8.25 GB", ByteSize(8.25 * (1 << 30))},
+		{"1.50 TB", ByteSize(1.5 * (1 << 40))},
+		{"512 MB", 512 << 20},
+		{"64 KB", 64 << 10},
+		{"2 gb", 2 << 30},
+		{"100 B", 100},
+		{"", 0},
+		{"8.25", 0},
+		{"8.25GB", 0},
+		{"abc GB", 0},
+		{"1 2 GB", 0},
+	}
+	for _, tt := range tests {
+		if got := parseBytes(tt.value); got != tt.want {
+			t.Errorf("parseBytes(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+// 格式化后再解析，与原值的误差不超过显示精度
+func TestFormatParseBytes(t *testing.T) {
+	for _, n := range []uint64{0, 500 << 20, 8 << 30, 3 << 40} {
+		got := uint64(parseBytes(formatBytes(n)))
+		if diff := max(got, n) - min(got, n); diff > 1<<40/100 {
+			t.Errorf("parseBytes(formatBytes(%d)) = %d", n, got)
+		}
+	}
+}
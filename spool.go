@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 离线缓存的上限，超出时丢弃最早的数据
+const (
+	spoolMaxFiles = 200
+	spoolMaxBytes = 64 << 20
+	spoolMaxAge   = 7 * 24 * time.Hour
+)
+
+// 发送失败的上报缓存在本地，每条一个文件，文件名为缓存时间，恢复连接后按顺序补报
+type reportSpool struct {
+	dir string
+}
+
+func newReportSpool() *reportSpool {
+	return &reportSpool{dir: filepath.Join(dataDir, "spool")}
+}
+
+// 缓存一条上报
+func (s *reportSpool) push(info *ClientInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	name := filepath.Join(s.dir, fmt.Sprintf("%020d.json", time.Now().UnixNano()))
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		return err
+	}
+	s.trim()
+	return nil
+}
+
+// 按缓存时间排序的文件列表
+func (s *reportSpool) entries() []os.DirEntry {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil
+	}
+	var files []os.DirEntry
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			files = append(files, e)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+	return files
+}
+
+// 删除过期数据，数量或总大小超出上限时从最早的开始删除
+func (s *reportSpool) trim() {
+	files := s.entries()
+	var total int64
+	sizes := make([]int64, len(files))
+	for i, e := range files {
+		if fi, err := e.Info(); err == nil {
+			sizes[i] = fi.Size()
+			total += sizes[i]
+		}
+	}
+	for i, e := range files {
+		count := len(files) - i
+		expired := false
+		if fi, err := e.Info(); err == nil {
+			expired = time.Since(fi.ModTime()) > spoolMaxAge
+		}
+		if !expired && count <= spoolMaxFiles && total <= spoolMaxBytes {
+			break
+		}
+		os.Remove(filepath.Join(s.dir, e.Name()))
+		total -= sizes[i]
+		log.Println("【Client】", "离线缓存超出上限，丢弃:", e.Name())
+	}
+}
+
+// 按顺序补报缓存的数据，发送成功或服务端明确拒绝的数据从缓存中删除
+// 遇到其他错误时停止，剩余数据下次再补报
+func (s *reportSpool) flush(send func(*ClientInfo) error) (int, error) {
+	s.trim()
+	sent := 0
+	for _, e := range s.entries() {
+		name := filepath.Join(s.dir, e.Name())
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		var info ClientInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			os.Remove(name)
+			continue
+		}
+		info.Replayed = true
+		err = send(&info)
+		var statusErr *reportStatusError
+		if errors.As(err, &statusErr) && statusErr.permanent() {
+			log.Println("【Client】", "服务端拒绝缓存的数据，丢弃:", e.Name(), err)
+			os.Remove(name)
+			continue
+		}
+		if err != nil {
+			return sent, err
+		}
+		os.Remove(name)
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 客户端本地状态（agent ID 等）保存目录，与日志目录同级
+const dataDir = "CInfoCollectData"
+
+func readStateFile(name string) string {
+	b, err := os.ReadFile(filepath.Join(dataDir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func writeStateFile(name string, data []byte) error {
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dataDir, name), data, 0600)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 任务类型
+const (
+	taskCollect     = "collect"      // 立即采集上报
+	taskCollectFull = "collect_full" // 立即采集上报，忽略配置中关闭的采集项
+	taskUploadLogs  = "upload_logs"  // 上传客户端日志
+	taskSetInterval = "set_interval" // 修改上报间隔，参数 {"interval": 分钟}
+)
+
+var allTaskTypes = []string{taskCollect, taskCollectFull, taskUploadLogs, taskSetInterval}
+
+// 任务状态
+const (
+	taskPending = "pending" // 等待客户端领取
+	taskRunning = "running" // 已被客户端领取
+	taskDone    = "done"
+	taskFailed  = "failed"
+)
+
+// 已领取但长时间未确认的任务（客户端中途退出等）重新下发
+const taskRedeliverAfter = time.Hour
+
+// 下发给客户端的任务
+type AgentTask struct {
+	ID       int64           `json:"id"`
+	HostID   string          `json:"host_id"`
+	Type     string          `json:"type"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Status   string          `json:"status"`
+	Result   string          `json:"result,omitempty"`
+	Created  string          `json:"created"`
+	Started  string          `json:"started,omitempty"`
+	Finished string          `json:"finished,omitempty"`
+}
+
+func (t AgentTask) String() string {
+	s := fmt.Sprintf("#%d %v %v %v", t.ID, t.Created, t.Type, t.Status)
+	if len(t.Params) > 0 {
+		s += " " + string(t.Params)
+	}
+	if t.Result != "" && t.Type != taskUploadLogs {
+		s += ": " + t.Result
+	}
+	return s
+}
+
+// 客户端执行任务后的确认
+type TaskAck struct {
+	ID     int64  `json:"id"`
+	Status string `json:"status"` // done 或 failed
+	Result string `json:"result,omitempty"`
+}
+
+const maxTaskResultSize = 1 << 20
+
+// 新增任务
+// 修改上报间隔的任务同时写入主机配置，避免下次上报响应中的配置将其覆盖
+func addTask(hostID, taskType string, params json.RawMessage) (int64, error) {
+	if !slices.Contains(allTaskTypes, taskType) {
+		return 0, fmt.Errorf("未知的任务类型: %v，可选 %v", taskType, strings.Join(allTaskTypes, "、"))
+	}
+	if taskType == taskSetInterval {
+		var p struct {
+			Interval int `json:"interval"`
+		}
+		if err := json.Unmarshal(params, &p); err != nil || p.Interval <= 0 {
+			return 0, fmt.Errorf("参数格式错误，应为 {\"interval\": 分钟}")
+		}
+		cfg, err := loadHostConfig(hostID)
+		if err != nil {
+			return 0, err
+		}
+		cfg.Interval = p.Interval
+		if err := setAgentConfig(configScopeHost, hostID, cfg); err != nil {
+			return 0, err
+		}
+	}
+	if len(params) == 0 {
+		params = nil
+	}
+	res, err := db.Exec("INSERT INTO agent_task (host_id, type, params, status, created) VALUES (?,?,?,?,?)",
+		hostID, taskType, string(params), taskPending, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// 主机级配置（不含默认和分组配置）
+func loadHostConfig(hostID string) (AgentConfig, error) {
+	var cfg AgentConfig
+	var text string
+	err := db.QueryRow("SELECT config FROM agent_config WHERE scope = ? AND name = ?", configScopeHost, hostID).Scan(&text)
+	if err == sql.ErrNoRows {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, json.Unmarshal([]byte(text), &cfg)
+}
+
+// 客户端领取任务，领取后状态改为 running
+func pollTasks(hostID string) ([]AgentTask, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// started 带时区偏移（夏令时切换前后不同），按 julianday 比较
+	now := time.Now()
+	rows, err := tx.Query(`SELECT `+agentTaskColumns+` FROM agent_task
+			WHERE host_id = ? AND (status = ? OR (status = ? AND julianday(started) < julianday(?)))
+			ORDER BY id`, hostID, taskPending, taskRunning, now.Add(-taskRedeliverAfter).Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := scanAgentTasks(rows)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tasks {
+		tasks[i].Status, tasks[i].Started = taskRunning, now.Format(time.RFC3339)
+		if _, err := tx.Exec("UPDATE agent_task SET status = ?, started = ? WHERE id = ?", taskRunning, tasks[i].Started, tasks[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return tasks, tx.Commit()
+}
+
+// 记录任务结果，只能确认属于该主机的任务
+func ackTask(hostID string, ack TaskAck) error {
+	if ack.Status != taskDone && ack.Status != taskFailed {
+		return fmt.Errorf("无效的任务状态: %v", ack.Status)
+	}
+	res, err := db.Exec("UPDATE agent_task SET status = ?, result = ?, finished = ? WHERE id = ? AND host_id = ?",
+		ack.Status, ack.Result, time.Now().Format(time.RFC3339), ack.ID, hostID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("任务 %d 不存在", ack.ID)
+	}
+	return nil
+}
+
+const agentTaskColumns = `id, host_id, type, params, status, result, created, started, finished`
+
+func scanAgentTasks(rows *sql.Rows) ([]AgentTask, error) {
+	defer rows.Close()
+	var tasks []AgentTask
+	for rows.Next() {
+		var t AgentTask
+		var params string
+		if err := rows.Scan(&t.ID, &t.HostID, &t.Type, &params, &t.Status, &t.Result, &t.Created, &t.Started, &t.Finished); err != nil {
+			return nil, err
+		}
+		if params != "" {
+			t.Params = json.RawMessage(params)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks, rows.Err()
+}
+
+// 查询任务，hostID 为空时查询所有主机，按时间倒序
+func queryTasks(hostID string, limit int) ([]AgentTask, error) {
+	query := `SELECT ` + agentTaskColumns + ` FROM agent_task`
+	var args []any
+	if hostID != "" {
+		query += ` WHERE host_id = ?`
+		args = append(args, hostID)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	rows, err := db.Query(query, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("任务查询失败: %v", err)
+	}
+	return scanAgentTasks(rows)
+}
+
+// 按 ID 查询任务
+func queryTask(id int64) (AgentTask, error) {
+	rows, err := db.Query(`SELECT `+agentTaskColumns+` FROM agent_task WHERE id = ?`, id)
+	if err != nil {
+		return AgentTask{}, fmt.Errorf("任务查询失败: %v", err)
+	}
+	tasks, err := scanAgentTasks(rows)
+	if err != nil {
+		return AgentTask{}, err
+	}
+	if len(tasks) == 0 {
+		return AgentTask{}, sql.ErrNoRows
+	}
+	return tasks[0], nil
+}
+
+// 上报记录的 HostID 可能被身份识别改写，任务按改写后的记录下发
+// 只查找该 agent 以已认证的 HostID 上报过的记录，不能凭 agent ID 领取其他主机的任务
+func recordHostID(reportedHostID, agentID string) string {
+	if agentID == "" {
+		return reportedHostID
+	}
+	var hostID string
+	err := db.QueryRow("SELECT host_id FROM host_identity WHERE agent_id = ? AND reported_host_id = ? ORDER BY last_seen DESC LIMIT 1",
+		agentID, reportedHostID).Scan(&hostID)
+	if err != nil {
+		return reportedHostID
+	}
+	return hostID
+}
+
+// 客户端领取任务：GET /tasks?host_id=&agent_id=
+func handleTaskPoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "只支持 GET 请求", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	data := ClientInfo{HostID: q.Get("host_id"), AgentID: q.Get("agent_id")}
+	if data.HostID == "" || !checkAgentRequest(w, r, nil, &data) {
+		if data.HostID == "" {
+			http.Error(w, "缺少 host_id", http.StatusBadRequest)
+		}
+		return
+	}
+	tasks, err := pollTasks(recordHostID(data.HostID, data.AgentID))
+	if err != nil {
+		log.Println("【Server】", "领取任务失败:", err)
+		http.Error(w, "服务端错误", http.StatusInternalServerError)
+		return
+	}
+	for _, t := range tasks {
+		log.Printf("【Server】 任务 #%d（%v）已由 %v 领取\n", t.ID, t.Type, t.HostID)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if tasks == nil {
+		tasks = []AgentTask{}
+	}
+	json.NewEncoder(w).Encode(tasks)
+}
+
+// 客户端确认任务：POST /tasks/ack?host_id=&agent_id=，请求体为 TaskAck
+func handleTaskAck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "只支持 POST 请求", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := readBody(w, r, maxTaskResultSize+4096)
+	if err != nil {
+		http.Error(w, "读取数据失败", http.StatusBadRequest)
+		return
+	}
+	q := r.URL.Query()
+	data := ClientInfo{HostID: q.Get("host_id"), AgentID: q.Get("agent_id")}
+	if data.HostID == "" {
+		http.Error(w, "缺少 host_id", http.StatusBadRequest)
+		return
+	}
+	if !checkAgentRequest(w, r, body, &data) {
+		return
+	}
+	var ack TaskAck
+	if err := json.Unmarshal(body, &ack); err != nil {
+		http.Error(w, "无效 JSON", http.StatusBadRequest)
+		return
+	}
+	hostID := recordHostID(data.HostID, data.AgentID)
+	if err := ackTask(hostID, ack); err != nil {
+		log.Println("【Server】", "确认任务失败:", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	log.Printf("【Server】 任务 #%d 执行结果: %v\n", ack.ID, ack.Status)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("OK"))
+}
+
+// 命令行新增或查看任务
+// 新增任务参数格式为 "HostID,类型" 或 "HostID,类型,JSON 参数"，查看任务参数为 HostID，"all" 表示所有主机
+func runTaskCommand(add, list string) {
+	if err := initDataBase(); err != nil {
+		log.Fatalln("【Server】", err)
+	}
+	defer closeDataBase()
+
+	if add != "" {
+		parts := strings.SplitN(add, ",", 3)
+		if len(parts) < 2 {
+			log.Fatalln("【Server】", "参数格式错误:", add)
+		}
+		var params json.RawMessage
+		if len(parts) == 3 {
+			params = json.RawMessage(parts[2])
+		}
+		id, err := addTask(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), params)
+		if err != nil {
+			log.Fatalln("【Server】", "新增任务失败:", err)
+		}
+		log.Printf("【Server】 已新增任务 #%d\n", id)
+	}
+	if list != "" {
+		hostID := list
+		if list == "all" {
+			hostID = ""
+		}
+		tasks, err := queryTasks(hostID, 100)
+		if err != nil {
+			log.Fatalln("【Server】", err)
+		}
+		for _, t := range tasks {
+			fmt.Println(t.HostID, t.String())
+		}
+		fmt.Println("共", strconv.Itoa(len(tasks)), "条")
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 证书 SHA-256 指纹，十六进制小写，客户端 -pin 参数使用此格式
+func certFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// 统一指纹格式，允许使用 AA:BB:... 形式
+func normalizeFingerprint(s string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(s), ":", ""))
+}
+
+// 服务端 TLS 配置，证书不存在且允许自动生成时生成自签名证书
+func loadServerTLSConfig(opts ServerOptions) (*tls.Config, error) {
+	if _, err := os.Stat(opts.CertFile); os.IsNotExist(err) && opts.GenCert {
+		log.Println("【Server】", "证书不存在，生成自签名证书:", opts.CertFile)
+		if err := generateSelfSignedCert(opts.CertFile, opts.KeyFile); err != nil {
+			return nil, fmt.Errorf("生成自签名证书失败: %v", err)
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("加载证书失败: %v", err)
+	}
+	if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+		log.Println("【Server】", "证书 SHA-256 指纹:", certFingerprint(leaf))
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	// 注册接口需要允许没有证书的客户端连接，是否必须提供证书由各接口判断
+	if agentCA != nil {
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		cfg.ClientCAs = agentCA.pool()
+	}
+	return cfg, nil
+}
+
+// 自签名证书包含本机主机名和所有网卡 IP，有效期 10 年
+func generateSelfSignedCert(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+	hostname, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname, Organization: []string{"CInfoCollect"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true, // 允许客户端直接将其作为 CA 证书信任
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname != "" {
+		tmpl.DNSNames = append(tmpl.DNSNames, hostname)
+	}
+	for _, iface := range getInterfaces() {
+		for _, cidr := range append(iface.IPv4, iface.IPv6...) {
+			if ip, _, err := net.ParseCIDR(cidr); err == nil {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(keyFile, "EC PRIVATE KEY", keyDer, 0600); err != nil {
+		return err
+	}
+	return writePEM(certFile, "CERTIFICATE", der, 0644)
+}
+
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm)
+}
+
+// 客户端 TLS 配置
+// 设置了指纹时只接受该证书（同时设置 CA 时还要求证书链有效），否则按 CA 证书或系统证书校验
+func loadClientTLSConfig(opts ClientOptions) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CAFile != "" {
+		pemData, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemData) {
+			return nil, fmt.Errorf("CA 证书中没有有效的证书: %v", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if opts.Pin != "" {
+		pin := normalizeFingerprint(opts.Pin)
+		cfg.InsecureSkipVerify = true // 由 VerifyConnection 校验
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return fmt.Errorf("服务端未提供证书")
+			}
+			leaf := cs.PeerCertificates[0]
+			if fp := certFingerprint(leaf); fp != pin {
+				return fmt.Errorf("服务端证书指纹不匹配: %v", fp)
+			}
+			if cfg.RootCAs == nil {
+				return nil
+			}
+			intermediates := x509.NewCertPool()
+			for _, c := range cs.PeerCertificates[1:] {
+				intermediates.AddCert(c)
+			}
+			_, err := leaf.Verify(x509.VerifyOptions{
+				Roots:         cfg.RootCAs,
+				Intermediates: intermediates,
+				DNSName:       cs.ServerName,
+			})
+			return err
+		}
+	}
+	return cfg, nil
+}
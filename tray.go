@@ -1,3 +1,5 @@
+//go:build windows && !headless
+
 package main
 
 import (
@@ -12,13 +14,18 @@ import (
 //go:embed icon.ico
 var iconData []byte
 
-func startServerWithTray(port, interval int) {
-	go startServer(port, interval)
+func startServerWithTray(opts ServerOptions) {
+	go startServer(opts)
+	// 控制台中按 Ctrl+C 时与托盘菜单退出一致
+	go func() {
+		log.Println("【Server】", "收到退出信号:", <-exitSignal())
+		systray.Quit()
+	}()
 	systray.Run(onServerReady, onServerExit)
 
 }
-func startClientWithTray(port int, ip string, interval int) {
-	go startClient(port, ip, interval)
+func startClientWithTray(opts ClientOptions) {
+	go startClient(opts)
 	systray.Run(onClientReady, onClientExit)
 }
 
@@ -32,9 +39,7 @@ func onClientExit() {
 	onExit("Client")
 }
 func onServerExit() {
-	if db != nil {
-		db.Close()
-	}
+	stopCollectService()
 	onExit("Server")
 
 }
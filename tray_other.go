@@ -0,0 +1,11 @@
+//go:build !windows || headless
+
+package main
+
+// 不支持系统托盘时，服务端以无界面模式运行，客户端直接在前台运行
+func startServerWithTray(opts ServerOptions) {
+	startHeadlessServer(opts)
+}
+func startClientWithTray(opts ClientOptions) {
+	startClient(opts)
+}
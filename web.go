@@ -0,0 +1,17 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+// 网页管理界面，与 gui.go 的窗口功能一致，通过 /api/v1 查询数据，无界面模式下同样可用
+//
+//go:embed web
+var webFiles embed.FS
+
+func registerWeb(mux *http.ServeMux) {
+	sub, _ := fs.Sub(webFiles, "web")
+	mux.Handle("/", http.FileServerFS(sub))
+}
@@ -0,0 +1,430 @@
+"use strict";
+
+// 与 gui.go 的窗口功能一致：分页表格、勾选、详情、导出、合并、立即采集
+// 合并、删除、立即采集需要管理员权限，未登录时显示登录框
+const api = "api/v1";
+
+const state = {
+  page: 1,
+  pageSize: 50,
+  sort: "updated",
+  order: "desc",
+  q: "",
+  online: "",
+  total: 0,
+  items: [],
+  checked: new Set(), // 勾选的 HostID，翻页时清空，与窗口一致
+  user: null,
+};
+
+const $ = (id) => document.getElementById(id);
+
+function setStatus(text) {
+  $("status").textContent = text;
+}
+
+// 请求失败时返回服务端的错误说明
+async function request(path, options) {
+  const resp = await fetch(`${api}/${path}`, options);
+  if (resp.status === 401 && path !== "login") {
+    showLogin();
+  }
+  if (!resp.ok) {
+    let message = `${resp.status} ${resp.statusText}`;
+    try {
+      const body = await resp.json();
+      message = body.error.message;
+    } catch (e) {
+      // 非 JSON 错误
+    }
+    throw new Error(message);
+  }
+  return resp;
+}
+
+async function getJSON(path) {
+  return (await request(path)).json();
+}
+
+function postJSON(path, body) {
+  return request(path, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify(body),
+  });
+}
+
+// 与 size.go 的 formatBytes 一致
+function formatBytes(n) {
+  if (n >= 2 ** 40) {
+    return (n / 2 ** 40).toFixed(2) + " TB";
+  }
+  return (n / 2 ** 30).toFixed(2) + " GB";
+}
+
+function showLogin() {
+  state.user = null;
+  $("login").hidden = false;
+  $("login-form").username.focus();
+}
+
+function showUser() {
+  $("user").textContent = `${state.user.username}（${state.user.role}）`;
+  document.querySelectorAll("button.admin").forEach((b) => {
+    b.hidden = state.user.role !== "admin";
+  });
+}
+
+async function start() {
+  try {
+    state.user = await getJSON("me");
+  } catch (e) {
+    return; // 未登录时 request 已显示登录框
+  }
+  showUser();
+  loadHosts();
+}
+
+$("login-form").addEventListener("submit", async (e) => {
+  e.preventDefault();
+  const form = e.target;
+  try {
+    await postJSON("login", { username: form.username.value, password: form.password.value });
+    form.password.value = "";
+    $("login-error").textContent = "";
+    $("login").hidden = true;
+    start();
+  } catch (err) {
+    $("login-error").textContent = err.message;
+  }
+});
+
+$("logout").addEventListener("click", async () => {
+  await fetch(`${api}/logout`, { method: "POST" });
+  state.items = [];
+  state.total = 0;
+  render();
+  $("detail").textContent = "";
+  $("user").textContent = "";
+  showLogin();
+});
+
+function pageCount() {
+  return state.total === 0 ? 1 : Math.ceil(state.total / state.pageSize);
+}
+
+async function loadHosts() {
+  const params = new URLSearchParams({
+    page: state.page,
+    page_size: state.pageSize,
+    sort: state.sort,
+    order: state.order,
+  });
+  if (state.q) params.set("q", state.q);
+  if (state.online) params.set("online", state.online);
+  try {
+    const list = await getJSON(`hosts?${params}`);
+    state.total = list.total;
+    state.items = list.items;
+    setStatus("");
+  } catch (e) {
+    state.items = [];
+    setStatus("查询失败: " + e.message);
+  }
+  state.checked.clear();
+  render();
+}
+
+function render() {
+  const tbody = document.querySelector("#hosts tbody");
+  tbody.replaceChildren();
+  state.items.forEach((h, i) => {
+    const tr = document.createElement("tr");
+    tr.dataset.hostId = h.host_id;
+    const box = document.createElement("input");
+    box.type = "checkbox";
+    box.checked = state.checked.has(h.host_id);
+    const cells = [
+      box,
+      (state.page - 1) * state.pageSize + i + 1,
+      h.host_id,
+      h.hostname,
+      h.username,
+      h.os,
+      h.cpu,
+      formatBytes(h.memory_total),
+      formatBytes(h.disk_total),
+      h.online ? "On" : "Off",
+      h.identity_flag || "",
+    ];
+    cells.forEach((v, col) => {
+      const td = document.createElement("td");
+      if (v instanceof Node) {
+        td.append(v);
+      } else {
+        td.textContent = v;
+      }
+      if (col === 9 && !h.online) td.className = "off";
+      if (col === 10) td.className = "flag";
+      tr.append(td);
+    });
+    tr.classList.toggle("checked", box.checked);
+    // 单击勾选，双击显示详情
+    tr.addEventListener("click", () => toggle(h.host_id));
+    tr.addEventListener("dblclick", () => showDetail(h.host_id, tr));
+    tbody.append(tr);
+  });
+
+  document.querySelectorAll("th[data-sort]").forEach((th) => {
+    th.classList.toggle("asc", th.dataset.sort === state.sort && state.order === "asc");
+    th.classList.toggle("desc", th.dataset.sort === state.sort && state.order === "desc");
+  });
+  $("page").value = state.page;
+  $("page-size").value = state.pageSize;
+  $("page-count").textContent = pageCount();
+  $("total").textContent = state.total;
+  $("prev-page").disabled = state.page <= 1;
+  $("next-page").disabled = state.page >= pageCount();
+  updateSelectAll();
+}
+
+function toggle(hostID) {
+  if (state.checked.has(hostID)) {
+    state.checked.delete(hostID);
+  } else {
+    state.checked.add(hostID);
+  }
+  const tr = document.querySelector(`tr[data-host-id="${CSS.escape(hostID)}"]`);
+  tr.classList.toggle("checked", state.checked.has(hostID));
+  tr.querySelector("input").checked = state.checked.has(hostID);
+  updateSelectAll();
+}
+
+function allChecked() {
+  return state.items.length > 0 && state.checked.size === state.items.length;
+}
+
+function updateSelectAll() {
+  $("select-all").textContent = allChecked() ? "取消全选" : "全选";
+}
+
+function checkedHosts() {
+  return state.items.filter((h) => state.checked.has(h.host_id));
+}
+
+// 详情格式与窗口中的详情一致
+async function showDetail(hostID, tr) {
+  document.querySelectorAll("tr.current").forEach((r) => r.classList.remove("current"));
+  tr.classList.add("current");
+  const detail = $("detail");
+  try {
+    const [host, events, tasks] = await Promise.all([
+      getJSON(`hosts/${encodeURIComponent(hostID)}`),
+      getJSON(`hosts/${encodeURIComponent(hostID)}/events?page_size=50`),
+      getJSON(`hosts/${encodeURIComponent(hostID)}/tasks`),
+    ]);
+    detail.textContent = formatDetail(host, events.items, tasks.items);
+  } catch (e) {
+    detail.textContent = "查询失败: " + e.message;
+  }
+}
+
+const detailFields = [
+  ["HostID", "host_id"],
+  ["AgentID", "agent_id"],
+  ["IdentityFlag", "identity_flag"],
+  ["Hostname", "hostname"],
+  ["Username", "username"],
+  ["OS", "os"],
+  ["CPU", "cpu"],
+  ["MemoryTotal", "memory_total", formatBytes],
+  ["MemoryUsed", "memory_used", formatBytes],
+  ["MemoryFree", "memory_free", formatBytes],
+  ["DiskTotal", "disk_total", formatBytes],
+  ["DiskUsed", "disk_used", formatBytes],
+  ["DiskFree", "disk_free", formatBytes],
+  ["Volumes", "volumes", (v) => `${v.mountpoint} ${v.filesystem} ${formatBytes(v.total)} (free ${formatBytes(v.free)})`],
+  ["PhysicalDisks", "physical_disks", (d) => [d.name, d.model, d.serial, formatBytes(d.size), d.media_type, d.bus].filter(Boolean).join(" ")],
+  ["Interfaces", "interfaces", (n) => [n.name, n.mac, n.up ? "up" : "down", ...(n.ipv4 || []), ...(n.ipv6 || [])].filter(Boolean).join(" ")],
+  ["Gateways", "gateways"],
+  ["DNSServers", "dns_servers"],
+  ["IPAddresses", "ip_addresses"],
+  ["MACAddresses", "mac_addresses"],
+  ["Programs", "programs", (p) => [p.name, p.version, p.publisher].filter(Boolean).join(" ")],
+  ["Updated", "updated"],
+  ["Endpoint", "endpoint"],
+  ["AgentVersion", "agent_version"],
+];
+
+function formatDetail(host, events, tasks) {
+  const width = 14;
+  const lines = [];
+  const label = (name) => name.padEnd(width) + ": ";
+  for (const [name, key, format] of detailFields) {
+    const value = host[key];
+    if (Array.isArray(value)) {
+      const rows = value.map((v) => (format ? format(v) : String(v)));
+      lines.push(label(name) + (rows[0] || ""));
+      rows.slice(1).forEach((r) => lines.push(" ".repeat(width + 2) + r));
+    } else {
+      lines.push(label(name) + (value === undefined ? "" : format ? format(value) : value));
+    }
+  }
+  if (events.length > 0) {
+    lines.push("", label("Changes").trimEnd());
+    events.forEach((e) => lines.push(`${e.time} ${e.kind} ${e.field}: ${e.old} -> ${e.new}`));
+  }
+  if (tasks.length > 0) {
+    lines.push("", label("Tasks").trimEnd());
+    tasks.forEach((t) => {
+      let s = `#${t.id} ${t.created} ${t.type} ${t.status}`;
+      if (t.params) s += " " + JSON.stringify(t.params);
+      if (t.result && t.type !== "upload_logs") s += ": " + t.result;
+      lines.push(s);
+    });
+  }
+  return lines.join("\n");
+}
+
+function gotoPage(page) {
+  page = Math.min(Math.max(1, page || 1), pageCount());
+  if (page !== state.page) {
+    state.page = page;
+    loadHosts();
+  } else {
+    $("page").value = state.page;
+  }
+}
+
+$("select-all").addEventListener("click", () => {
+  const check = !allChecked();
+  state.checked.clear();
+  if (check) state.items.forEach((h) => state.checked.add(h.host_id));
+  render();
+});
+
+$("export").addEventListener("click", async () => {
+  const hosts = checkedHosts();
+  if (hosts.length === 0) {
+    alert("未勾选任何行");
+    return;
+  }
+  try {
+    const resp = await postJSON("hosts/export", { host_ids: hosts.map((h) => h.host_id) });
+    const a = document.createElement("a");
+    a.href = URL.createObjectURL(await resp.blob());
+    a.download = "导出.xlsx";
+    a.click();
+    URL.revokeObjectURL(a.href);
+  } catch (e) {
+    alert("导出失败: " + e.message);
+  }
+});
+
+// 勾选的记录合并到最近上报的一条
+$("merge").addEventListener("click", async () => {
+  const hosts = checkedHosts();
+  if (hosts.length < 2) {
+    alert("请至少勾选两条记录");
+    return;
+  }
+  // 客户端时区可能不同，按时间点比较
+  const keep = hosts.reduce((a, b) => (Date.parse(b.updated) > Date.parse(a.updated) ? b : a));
+  if (!confirm(`将勾选的 ${hosts.length} 条记录合并到 ${keep.hostname}（${keep.host_id}），是否继续？`)) {
+    return;
+  }
+  try {
+    await postJSON("hosts/merge", {
+      keep: keep.host_id,
+      drop: hosts.filter((h) => h !== keep).map((h) => h.host_id),
+    });
+    alert("合并成功");
+    loadHosts();
+  } catch (e) {
+    alert("合并失败: " + e.message);
+  }
+});
+
+$("collect").addEventListener("click", async () => {
+  const hosts = checkedHosts();
+  if (hosts.length === 0) {
+    alert("请勾选记录");
+    return;
+  }
+  let n = 0;
+  for (const h of hosts) {
+    try {
+      await postJSON(`hosts/${encodeURIComponent(h.host_id)}/tasks`, { type: "collect" });
+      n++;
+    } catch (e) {
+      alert("下发任务失败: " + e.message);
+      break;
+    }
+  }
+  if (n > 0) alert(`已下发 ${n} 个采集任务`);
+});
+
+$("delete").addEventListener("click", async () => {
+  const hosts = checkedHosts();
+  if (hosts.length === 0) {
+    alert("请勾选记录");
+    return;
+  }
+  if (!confirm(`删除勾选的 ${hosts.length} 条记录及其历史数据，是否继续？`)) {
+    return;
+  }
+  for (const h of hosts) {
+    try {
+      await request(`hosts/${encodeURIComponent(h.host_id)}`, { method: "DELETE" });
+    } catch (e) {
+      alert("删除失败: " + e.message);
+      break;
+    }
+  }
+  loadHosts();
+});
+
+$("reset").addEventListener("click", () => {
+  Object.assign(state, { page: 1, pageSize: 50, sort: "updated", order: "desc", q: "", online: "" });
+  $("search").value = "";
+  $("online-filter").value = "";
+  $("detail").textContent = "";
+  loadHosts();
+});
+
+$("search").addEventListener("change", (e) => {
+  state.q = e.target.value.trim();
+  state.page = 1;
+  loadHosts();
+});
+
+$("online-filter").addEventListener("change", (e) => {
+  state.online = e.target.value;
+  state.page = 1;
+  loadHosts();
+});
+
+document.querySelectorAll("th[data-sort]").forEach((th) => {
+  th.addEventListener("click", () => {
+    if (state.sort === th.dataset.sort) {
+      state.order = state.order === "asc" ? "desc" : "asc";
+    } else {
+      state.sort = th.dataset.sort;
+      state.order = "asc";
+    }
+    state.page = 1;
+    loadHosts();
+  });
+});
+
+$("prev-page").addEventListener("click", () => gotoPage(state.page - 1));
+$("next-page").addEventListener("click", () => gotoPage(state.page + 1));
+$("page").addEventListener("change", (e) => gotoPage(parseInt(e.target.value, 10)));
+$("page-size").addEventListener("change", (e) => {
+  const size = Math.min(Math.max(1, parseInt(e.target.value, 10) || 1), 500);
+  state.pageSize = size;
+  state.page = 1; // 更改页大小回到第一页
+  loadHosts();
+});
+
+start();